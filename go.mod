@@ -2,14 +2,16 @@ module github.com/ezra-sullivan/net-sniff
 
 go 1.24.1
 
-require github.com/spf13/cobra v1.9.1
+require (
+	github.com/prometheus-community/pro-bing v0.7.0
+	github.com/spf13/cobra v1.9.1
+	github.com/spf13/pflag v1.0.6
+	golang.org/x/net v0.38.0
+)
 
 require (
 	github.com/google/uuid v1.6.0 // indirect
 	github.com/inconshreveable/mousetrap v1.1.0 // indirect
-	github.com/prometheus-community/pro-bing v0.7.0 // indirect
-	github.com/spf13/pflag v1.0.6 // indirect
-	golang.org/x/net v0.38.0 // indirect
 	golang.org/x/sync v0.13.0 // indirect
 	golang.org/x/sys v0.31.0 // indirect
 )
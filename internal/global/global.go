@@ -0,0 +1,25 @@
+package global
+
+import (
+	"github.com/ezra-sullivan/net-sniff/internal/initialize/options"
+)
+
+// Logger 定义日志输出接口
+// *slog.Logger 满足该接口，测试或嵌入扫描器时可以替换为自定义实现
+type Logger interface {
+	Debug(msg string, args ...any)
+	Info(msg string, args ...any)
+	Warn(msg string, args ...any)
+	Error(msg string, args ...any)
+}
+
+var (
+	// Opts 全局配置选项
+	Opts *options.Options
+
+	// ConsoleLogger 控制台日志
+	ConsoleLogger Logger
+
+	// FileLogger 结果文件日志，未指定输出文件时为 nil
+	FileLogger Logger
+)
@@ -0,0 +1,18 @@
+package initialize
+
+import (
+	"github.com/ezra-sullivan/net-sniff/internal/global"
+	"github.com/ezra-sullivan/net-sniff/internal/initialize/logger"
+	"github.com/ezra-sullivan/net-sniff/internal/initialize/options"
+)
+
+// InitAll 初始化全局选项和日志
+func InitAll() error {
+	// 初始化全局选项
+	global.Opts = &options.Options{}
+
+	// 初始化控制台日志，日志级别在解析命令行参数后由 logger.Setup 调整
+	logger.Init()
+
+	return nil
+}
@@ -0,0 +1,230 @@
+package logger
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"strings"
+	"sync"
+
+	"github.com/ezra-sullivan/net-sniff/internal/global"
+	"github.com/ezra-sullivan/net-sniff/internal/initialize/options"
+)
+
+var (
+	// level 控制台和文件日志共用的日志级别
+	// 命令创建时就会持有 ConsoleLogger，因此只调整级别而不替换日志实例
+	level = new(slog.LevelVar)
+
+	// outputFile 当前打开的结果文件
+	outputFile *os.File
+)
+
+// Init 初始化控制台日志，默认日志级别为 info
+func Init() {
+	level.Set(slog.LevelInfo)
+	global.ConsoleLogger = NewConsoleLogger(os.Stdout, level)
+	global.FileLogger = nil
+}
+
+// Setup 根据命令行参数设置日志级别并打开结果文件
+func Setup(opts *options.Options) error {
+	// 解析日志级别
+	lvl, err := ParseLevel(opts.LogLevel)
+	if err != nil {
+		return err
+	}
+
+	// 详细模式下输出所有调试信息
+	if opts.Verbose {
+		lvl = slog.LevelDebug
+	}
+	level.Set(lvl)
+
+	// 未指定输出文件时不创建文件日志
+	if opts.OutputFile == "" {
+		return nil
+	}
+
+	file, err := os.Create(opts.OutputFile)
+	if err != nil {
+		return fmt.Errorf("创建输出文件失败: %w", err)
+	}
+	outputFile = file
+	global.FileLogger = NewFileLogger(file, level)
+
+	return nil
+}
+
+// Close 关闭结果文件
+func Close() error {
+	global.FileLogger = nil
+	if outputFile == nil {
+		return nil
+	}
+
+	err := outputFile.Close()
+	outputFile = nil
+	if err != nil {
+		return fmt.Errorf("关闭输出文件失败: %w", err)
+	}
+	return nil
+}
+
+// ParseLevel 解析日志级别字符串，支持 debug, info, warn, error
+func ParseLevel(s string) (slog.Level, error) {
+	var lvl slog.Level
+	if s == "" {
+		return slog.LevelInfo, nil
+	}
+	if err := lvl.UnmarshalText([]byte(strings.TrimSpace(s))); err != nil {
+		return lvl, fmt.Errorf("无效的日志级别: %s", s)
+	}
+	return lvl, nil
+}
+
+// NewConsoleLogger 创建基于 slog 的控制台日志
+func NewConsoleLogger(w io.Writer, leveler slog.Leveler) *slog.Logger {
+	return slog.New(slog.NewTextHandler(w, &slog.HandlerOptions{Level: leveler}))
+}
+
+// NewFileLogger 创建结果文件日志，每条日志只写入消息本身（即一行 CSV 记录）
+func NewFileLogger(w io.Writer, leveler slog.Leveler) *slog.Logger {
+	return slog.New(&lineHandler{
+		w:     w,
+		level: leveler,
+		mu:    &sync.Mutex{},
+	})
+}
+
+// OutputFileHeader 在结果文件第一行写入列名，未指定输出文件时不写入
+// 需要在写入任何结果之前调用；不受日志级别影响
+func OutputFileHeader(columns string) {
+	if outputFile == nil {
+		return
+	}
+	_, _ = io.WriteString(outputFile, columns+"\n")
+}
+
+// OutputStart 输出任务开始信息
+func OutputStart(name string, hostCount int, portCount int) {
+	consoleLogger := global.ConsoleLogger
+
+	// 端口数为 0 表示该任务不涉及端口（如 Ping）
+	if portCount > 0 {
+		consoleLogger.Info(fmt.Sprintf("开始 %s", name),
+			"hosts", hostCount,
+			"ports", portCount,
+			"total", hostCount*portCount,
+		)
+		return
+	}
+
+	consoleLogger.Info(fmt.Sprintf("开始 %s", name),
+		"hosts", hostCount,
+	)
+}
+
+// OutputStartEndpoints 输出显式指定 host:port 目标的任务开始信息
+func OutputStartEndpoints(name string, endpointCount int) {
+	consoleLogger := global.ConsoleLogger
+	consoleLogger.Info(fmt.Sprintf("开始 %s", name),
+		"targets", endpointCount,
+	)
+}
+
+// OutputSummary 输出任务总结信息
+func OutputSummary(name string, successCount int, total int) {
+	consoleLogger := global.ConsoleLogger
+	consoleLogger.Info(fmt.Sprintf("%s 完成", name),
+		"success", successCount,
+		"failed", total-successCount,
+		"total", total,
+	)
+}
+
+// OutputPingSummary 输出每个主机发送多个包的 ping 总结信息，包括总的收发包数和丢包率
+func OutputPingSummary(name string, successCount, total, sent, recv int) {
+	loss := 0.0
+	if sent > 0 {
+		loss = float64(sent-recv) / float64(sent) * 100
+	}
+
+	consoleLogger := global.ConsoleLogger
+	consoleLogger.Info(fmt.Sprintf("%s 完成", name),
+		"success", successCount,
+		"failed", total-successCount,
+		"total", total,
+		"sent", sent,
+		"recv", recv,
+		"loss", fmt.Sprintf("%.1f%%", loss),
+	)
+}
+
+// OutputPortSummary 输出端口扫描总结信息，按端口状态分别计数
+func OutputPortSummary(name string, openCount, closedCount, filteredCount int) {
+	consoleLogger := global.ConsoleLogger
+	consoleLogger.Info(fmt.Sprintf("%s 完成", name),
+		"open", openCount,
+		"closed", closedCount,
+		"filtered", filteredCount,
+		"total", openCount+closedCount+filteredCount,
+	)
+}
+
+// OutputUDPPortSummary 输出 UDP 扫描总结信息，除开放、关闭和被过滤外还统计没有响应 (open|filtered) 的端口
+func OutputUDPPortSummary(name string, openCount, openFilteredCount, closedCount, filteredCount int) {
+	consoleLogger := global.ConsoleLogger
+	consoleLogger.Info(fmt.Sprintf("%s 完成", name),
+		"open", openCount,
+		"open|filtered", openFilteredCount,
+		"closed", closedCount,
+		"filtered", filteredCount,
+		"total", openCount+openFilteredCount+closedCount+filteredCount,
+	)
+}
+
+// CSVField 将字段转换为结果文件中的 CSV 字段，包含逗号、引号或换行时用双引号包裹
+func CSVField(s string) string {
+	if !strings.ContainsAny(s, ",\"\r\n") {
+		return s
+	}
+	return `"` + strings.ReplaceAll(s, `"`, `""`) + `"`
+}
+
+// lineHandler 是只输出消息文本的 slog.Handler，用于写入结果文件
+type lineHandler struct {
+	w     io.Writer
+	level slog.Leveler
+	mu    *sync.Mutex
+}
+
+// Enabled 判断日志级别是否需要输出
+func (h *lineHandler) Enabled(_ context.Context, l slog.Level) bool {
+	return l >= h.level.Level()
+}
+
+// Handle 写入一行记录，忽略所有属性
+func (h *lineHandler) Handle(_ context.Context, r slog.Record) error {
+	msg := r.Message
+	if !strings.HasSuffix(msg, "\n") {
+		msg += "\n"
+	}
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	_, err := io.WriteString(h.w, msg)
+	return err
+}
+
+// WithAttrs 结果文件不记录属性，直接返回自身
+func (h *lineHandler) WithAttrs(_ []slog.Attr) slog.Handler {
+	return h
+}
+
+// WithGroup 结果文件不记录分组，直接返回自身
+func (h *lineHandler) WithGroup(_ string) slog.Handler {
+	return h
+}
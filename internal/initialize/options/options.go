@@ -2,12 +2,41 @@ package options
 
 // Options 定义全局配置选项
 type Options struct {
-	Hosts       string
-	Ports       string
-	Concurrency int
-	Timeout     int
-	Verbose     bool
-	Mode        string
-	OutputFile  string
-	LogLevel    string
+	Hosts         string
+	Ports         string
+	Targets       string
+	TopPorts      int
+	ExcludePorts  string
+	SkipPing      bool
+	Banner        bool
+	BannerProbe   string
+	BannerTimeout int
+	ServiceDetect bool
+	ServiceProbes string
+	UDPPayload    string
+	UDPPayloads   string
+	TLS           bool
+	TLSWarnDays   int
+	HTTPProbe     bool
+	HTTPRedirects int
+	HTTPTimeout   int
+	Exclude       string
+	ExcludeFile   string
+	Resolver      string
+	AllAddrs      bool
+	ResolveNames  bool
+	Concurrency   int
+	Timeout       int
+	Retries       int
+	UDPRetries    int
+	PingRetries   int
+	PingCount     int
+	PingInterval  int
+	Privileged    bool
+	Unprivileged  bool
+	RetryBackoff  int
+	Verbose       bool
+	Mode          string
+	OutputFile    string
+	LogLevel      string
 }
@@ -1,46 +1,98 @@
 package ping
 
 import (
+	"context"
 	"fmt"
 	"github.com/ezra-sullivan/net-sniff/internal/global"
-	"sync"
+	"github.com/ezra-sullivan/net-sniff/internal/initialize/logger"
+	"github.com/ezra-sullivan/net-sniff/internal/resolve"
+	"github.com/ezra-sullivan/net-sniff/internal/retry"
+	"github.com/ezra-sullivan/net-sniff/internal/workpool"
+	"iter"
+	"log/slog"
+	"math"
+	"net/netip"
+	"slices"
 	"time"
 
 	probing "github.com/prometheus-community/pro-bing"
 )
 
+// Config ping 的配置，为 nil 时使用特权模式并且只发送一个包
+type Config struct {
+	Count      int           // 每次 ping 发送的包数，不大于 1 时只发送一个包
+	Interval   time.Duration // 两个包之间的间隔
+	Privileged bool          // 使用原始套接字（特权模式），否则使用 ICMP 数据报套接字，见 Privileged
+}
+
 // Result 存储 ping 的结果
 type Result struct {
-	Success bool
-	Host    string
-	TTL     uint8
-	Time    time.Duration
-	Error   error
+	Success     bool
+	Host        string
+	Addr        string // 实际 ping 的 IP 地址
+	Name        string // 启用反向解析时，存活主机的 IP 地址对应的主机名
+	TTL         uint8
+	Time        time.Duration // 平均往返时间，没有收到回复时为 ping 的总耗时
+	PacketsSent int
+	PacketsRecv int
+	Loss        float64 // 丢包率（百分比）
+	MinRTT      time.Duration
+	MaxRTT      time.Duration
+	StdDevRTT   time.Duration
+	Jitter      time.Duration // 相邻两次往返时间之差的平均值
+	Attempts    int           // 发送 ping 的次数，包括重试
+	Error       error
 }
 
 // SinglePing 对单个主机执行 ping 操作
 func SinglePing(host string, timeout time.Duration) Result {
+	return SinglePingContext(context.Background(), host, timeout)
+}
+
+// SinglePingContext 对单个主机执行 ping 操作，上下文取消时立即中止
+func SinglePingContext(ctx context.Context, host string, timeout time.Duration) Result {
+	return pingAddr(ctx, nil, host, host, timeout, nil, nil)
+}
+
+// SinglePingRetry 对单个主机执行 ping 操作，没有收到回复时按 retries 重试
+func SinglePingRetry(ctx context.Context, host string, timeout time.Duration, retries *retry.Policy) Result {
+	return pingAddr(ctx, nil, host, host, timeout, retries, nil)
+}
+
+// MultiPing 对单个主机按 config 发送多个包，结果中包含丢包率和往返时间统计，没有收到任何回复时按 retries 重试
+func MultiPing(ctx context.Context, host string, timeout time.Duration, retries *retry.Policy, config *Config) Result {
+	return pingAddr(ctx, nil, host, host, timeout, retries, config)
+}
+
+// pingAddr 对 addr 执行 ping 操作，结果中记录原始主机 host，主机存活时通过 resolver 反向解析 host
+// retries 不为 nil 时，没有收到回复的 ping 按重试策略重新发送；config 为 nil 时使用特权模式并且只发送一个包
+func pingAddr(ctx context.Context, resolver *resolve.Resolver, host, addr string, timeout time.Duration, retries *retry.Policy, config *Config) Result {
 	result := Result{
 		Host: host,
 	}
 
-	// 创建新的 pinger
-	pinger, err := probing.NewPinger(host)
-	if err != nil {
-		result.Success = false
-		result.Error = err
-		return result
-	}
+	var err error
+	result.Attempts = retries.Do(ctx, func(int) bool {
+		// 每次 ping 使用新的 pinger
+		var pinger *probing.Pinger
+		if pinger, err = newPinger(addr, timeout, config); err != nil {
+			return false
+		}
+		result.Addr = pinger.IPAddr().String()
 
-	// 设置 ping 参数
-	pinger.Count = 1
-	pinger.Timeout = timeout   // 使用传入的超时值
-	pinger.SetPrivileged(true) // Windows 系统需要设置为 true
+		// 执行 ping
+		startTime := time.Now()
+		err = pinger.RunWithContext(ctx)
+		result.Time = time.Since(startTime)
+		if err != nil {
+			return false
+		}
 
-	// 执行 ping
-	startTime := time.Now()
-	err = pinger.Run()
-	result.Time = time.Since(startTime)
+		// 获取统计信息，往返时间使用回复的时间而不是包括创建 pinger 在内的总耗时
+		result.setStatistics(pinger.Statistics())
+		// 没有收到任何回复时重试
+		return !result.Success && ctx.Err() == nil
+	})
 
 	if err != nil {
 		result.Success = false
@@ -48,11 +100,9 @@ func SinglePing(host string, timeout time.Duration) Result {
 		return result
 	}
 
-	// 获取统计信息
-	stats := pinger.Statistics()
-	result.Success = stats.PacketsRecv > 0
 	if result.Success {
-		result.TTL = stats.TTLs[0]
+		// 主机存活时反向解析主机名
+		result.Name = resolver.LookupName(ctx, host)
 	} else if result.Error == nil {
 		// 当没有收到任何数据包但没有错误时，设置一个有意义的错误信息
 		result.Error = fmt.Errorf("目标主机不可达或未响应")
@@ -64,38 +114,119 @@ func SinglePing(host string, timeout time.Duration) Result {
 	return result
 }
 
-// BatchPing 对多个主机执行批量 ping 操作
-func BatchPing(hosts []string, concurrency int, timeout time.Duration) []Result {
-	results := make([]Result, 0, len(hosts))
-	resultsChan := make(chan Result, len(hosts))
+// setStatistics 记录 pinger 的统计信息
+func (result *Result) setStatistics(stats *probing.Statistics) {
+	result.Success = stats.PacketsRecv > 0
+	result.PacketsSent = stats.PacketsSent
+	result.PacketsRecv = stats.PacketsRecv
+	result.Loss = stats.PacketLoss
+	if !result.Success {
+		return
+	}
+
+	result.TTL = stats.TTLs[0]
+	result.Time = stats.AvgRtt
+	result.MinRTT = stats.MinRtt
+	result.MaxRTT = stats.MaxRtt
+	result.StdDevRTT = stats.StdDevRtt
+	result.Jitter = jitter(stats.Rtts)
+}
 
-	// 使用信号量控制并发
-	sem := make(chan struct{}, concurrency)
-	var wg sync.WaitGroup
+// jitter 计算相邻两次往返时间之差的绝对值的平均值，少于两个回复时为 0
+func jitter(rtts []time.Duration) time.Duration {
+	if len(rtts) < 2 {
+		return 0
+	}
 
-	for _, host := range hosts {
-		wg.Add(1)
-		go func(h string) {
-			defer wg.Done()
-			sem <- struct{}{}        // 获取信号量
-			defer func() { <-sem }() // 释放信号量
+	var sum time.Duration
+	for i := 1; i < len(rtts); i++ {
+		sum += max(rtts[i]-rtts[i-1], rtts[i-1]-rtts[i])
+	}
+	return sum / time.Duration(len(rtts)-1)
+}
 
-			resultsChan <- SinglePing(h, timeout) // 传递超时参数
-		}(host)
+// newPinger 创建 pinger 并解析目标地址，config 为 nil 时使用特权模式并且只发送一个包
+func newPinger(addr string, timeout time.Duration, config *Config) (*probing.Pinger, error) {
+	// 创建新的 pinger
+	pinger := probing.New(addr)
+
+	// IPv6 地址使用 ICMPv6，IPv4 地址使用 ICMP，主机名由解析结果决定
+	if ip, err := netip.ParseAddr(addr); err == nil {
+		if ip.Unmap().Is4() {
+			pinger.SetNetwork("ip4")
+		} else {
+			pinger.SetNetwork("ip6")
+		}
 	}
 
-	// 等待所有 goroutine 完成
-	go func() {
-		wg.Wait()
-		close(resultsChan)
-	}()
+	// 解析目标地址
+	if err := pinger.Resolve(); err != nil {
+		return nil, err
+	}
+
+	// 设置 ping 参数
+	pinger.Count = 1
+	pinger.Timeout = timeout // 使用传入的超时值
+	if config != nil && config.Count > 1 {
+		// 超时时间是整个 ping 的时间，需要加上发送其余包的间隔
+		pinger.Count = config.Count
+		pinger.Interval = config.Interval
+		pinger.Timeout = timeout + time.Duration(config.Count-1)*config.Interval
+	}
+	pinger.SetPrivileged(config == nil || config.Privileged) // Windows 系统需要设置为 true
+	return pinger, nil
+}
+
+// BatchPing 对多个主机执行批量 ping 操作
+func BatchPing(hosts []string, concurrency int, timeout time.Duration) []Result {
+	results, _ := BatchPingContext(context.Background(), hosts, concurrency, timeout)
+	return results
+}
+
+// BatchPingContext 对多个主机执行批量 ping 操作
+// 上下文取消后不再派发新任务并中止进行中的 ping，返回已完成的结果和 ctx.Err()
+func BatchPingContext(ctx context.Context, hosts []string, concurrency int, timeout time.Duration) ([]Result, error) {
+	results := make([]Result, 0, len(hosts))
 
 	// 收集结果
-	for result := range resultsChan {
+	for result := range StreamPing(ctx, resolve.Default(), slices.Values(hosts), concurrency, timeout, nil, nil) {
 		results = append(results, result)
 	}
 
-	return results
+	return results, ctx.Err()
+}
+
+// StreamPing 使用固定大小的工作池对惰性生成的主机序列执行 ping，结果到达即发送到返回的通道
+// 每个主机名在 ping 前只解析一次；内存占用与主机数量无关；全部完成或上下文取消后通道关闭，调用方必须读完通道
+// retries 不为 nil 时，没有收到回复的 ping 按重试策略重新发送；config 为 nil 时使用特权模式并且只发送一个包；resolver 为 nil 时使用 resolve.Default()
+func StreamPing(ctx context.Context, resolver *resolve.Resolver, hosts iter.Seq[string], concurrency int, timeout time.Duration, retries *retry.Policy, config *Config) <-chan Result {
+	if resolver == nil {
+		resolver = resolve.Default()
+	}
+	return workpool.Run(ctx, pingTargets(resolver.Stream(ctx, hosts, concurrency)), concurrency, func(ctx context.Context, t pingTarget) (Result, bool) {
+		result := pingAddr(ctx, resolver, t.host, t.addr, timeout, retries, config) // 传递超时参数
+		// 因取消而中止的 ping 不计入结果
+		return result, ctx.Err() == nil || result.Success
+	})
+}
+
+// pingTarget 单个 ping 目标（主机 + 解析后的地址）
+type pingTarget struct {
+	host string
+	addr string
+}
+
+// pingTargets 按需展开解析后的主机地址
+func pingTargets(hosts iter.Seq[resolve.Host]) iter.Seq[pingTarget] {
+	return func(yield func(pingTarget) bool) {
+		for host := range hosts {
+			for _, addr := range host.Addrs {
+				if !yield(pingTarget{host: host.Name, addr: addr}) {
+					return
+				}
+			}
+		}
+	}
 }
 
 // 定义 Result 结构体的 output 方法
@@ -110,13 +241,21 @@ func (result *Result) output() {
 			"Ping Result",
 			"status", "success",
 			"host", result.Host,
+			"ip", result.Addr,
+			resolve.NameAttr(result.Name),
 			"ttl", result.TTL,
-			"time_ms", float64(result.Time.Microseconds())/1000.0)
+			"time_ms", float64(result.Time.Microseconds())/1000.0,
+			statsAttr(result),
+			retry.AttemptsAttr(result.Attempts))
 	} else {
 		// 打印 Ping 失败结果
 		consoleLogger.Debug("Ping Result",
 			"status", "failed",
 			"host", result.Host,
+			"ip", result.Addr,
+			resolve.NameAttr(result.Name),
+			statsAttr(result),
+			retry.AttemptsAttr(result.Attempts),
 			"err", result.Error,
 		)
 	}
@@ -129,11 +268,47 @@ func (result *Result) output() {
 		// 如果 Ping 成功
 		if result.Success {
 			// 打印Ping结果到文件
-			fileLogger.Info(fmt.Sprintf("%s,%d,%s,%s,%.2f\n", result.Host, result.TTL, "success", "success", float64(result.Time.Microseconds())/1000.0))
+			fileLogger.Info(fmt.Sprintf("%s,%d,%s,%s,%.2f,%s,%s,%s\n", result.Host, result.TTL, "success", "success", float64(result.Time.Microseconds())/1000.0, result.Name, statsFields(result), result.Addr))
 
 		} else {
 			// 打印 Ping 失败结果到文件
-			fileLogger.Debug(fmt.Sprintf("%s,%d,%s,%s,%.2f\n", result.Host, result.TTL, "failed", result.Error, float64(result.Time.Microseconds())/1000.0))
+			fileLogger.Debug(fmt.Sprintf("%s,%d,%s,%s,%.2f,%s,%s,%s\n", result.Host, result.TTL, "failed", logger.CSVField(fmt.Sprint(result.Error)), float64(result.Time.Microseconds())/1000.0, result.Name, statsFields(result), result.Addr))
 		}
 	}
 }
+
+// Columns ping 结果文件的列名，新增的列只追加在末尾
+const Columns = "host,ttl,status,result,time_ms,name,sent,recv,loss,min_ms,max_ms,stddev_ms,jitter_ms,ip"
+
+// statsAttr 返回用于日志输出的多包统计属性组，只发送一个包时返回空属性（不会被输出）
+func statsAttr(result *Result) slog.Attr {
+	if result.PacketsSent <= 1 {
+		return slog.Attr{}
+	}
+
+	attrs := []any{
+		"sent", result.PacketsSent,
+		"recv", result.PacketsRecv,
+		"loss", fmt.Sprintf("%.1f%%", result.Loss),
+	}
+	if result.Success {
+		attrs = append(attrs,
+			"min_ms", milliseconds(result.MinRTT),
+			"max_ms", milliseconds(result.MaxRTT),
+			"stddev_ms", milliseconds(result.StdDevRTT),
+			"jitter_ms", milliseconds(result.Jitter),
+		)
+	}
+	return slog.Group("stats", attrs...)
+}
+
+// statsFields 返回结果文件中的统计列：发送数、接收数、丢包率、最小/最大往返时间、标准差、抖动
+func statsFields(result *Result) string {
+	return fmt.Sprintf("%d,%d,%.1f,%.2f,%.2f,%.2f,%.2f", result.PacketsSent, result.PacketsRecv, result.Loss,
+		milliseconds(result.MinRTT), milliseconds(result.MaxRTT), milliseconds(result.StdDevRTT), milliseconds(result.Jitter))
+}
+
+// milliseconds 将时间转换为保留两位小数的毫秒数
+func milliseconds(d time.Duration) float64 {
+	return math.Round(float64(d.Microseconds())/10.0) / 100.0
+}
@@ -0,0 +1,119 @@
+package ping
+
+import (
+	"encoding/csv"
+	"errors"
+	"io"
+	"log/slog"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ezra-sullivan/net-sniff/internal/global"
+)
+
+// lineLogger 记录写入结果文件的行
+type lineLogger struct {
+	lines []string
+}
+
+func (l *lineLogger) Debug(msg string, _ ...any) { l.lines = append(l.lines, msg) }
+func (l *lineLogger) Info(msg string, _ ...any)  { l.lines = append(l.lines, msg) }
+func (l *lineLogger) Warn(msg string, _ ...any)  { l.lines = append(l.lines, msg) }
+func (l *lineLogger) Error(msg string, _ ...any) { l.lines = append(l.lines, msg) }
+
+func TestResultOutputColumns(t *testing.T) {
+	global.ConsoleLogger = slog.New(slog.NewTextHandler(io.Discard, nil))
+	defer func() {
+		global.FileLogger = nil
+	}()
+
+	columns := strings.Split(Columns, ",")
+
+	tests := []struct {
+		name   string
+		result Result
+		status string
+		detail string // result 列
+	}{
+		{
+			name:   "成功",
+			result: Result{Success: true, Host: "example.com", Addr: "192.0.2.1", Name: "host.example", TTL: 64, Time: 1500 * time.Microsecond},
+			status: "success",
+			detail: "success",
+		},
+		{
+			name: "多包统计",
+			result: Result{Success: true, Host: "192.0.2.1", Addr: "192.0.2.1", TTL: 64, Time: time.Millisecond,
+				PacketsSent: 4, PacketsRecv: 3, Loss: 25, MinRTT: time.Millisecond, MaxRTT: 2 * time.Millisecond},
+			status: "success",
+			detail: "success",
+		},
+		{
+			name:   "失败",
+			result: Result{Host: "192.0.2.2", Addr: "192.0.2.2", Error: errors.New("目标主机不可达或未响应")},
+			status: "failed",
+			detail: "目标主机不可达或未响应",
+		},
+		{
+			name:   "错误信息包含逗号、引号和换行",
+			result: Result{Host: "192.0.2.3", Addr: "192.0.2.3", Error: errors.New("dial ip4:icmp 192.0.2.3: \"denied\", retry\nlater")},
+			status: "failed",
+			detail: "dial ip4:icmp 192.0.2.3: \"denied\", retry\nlater",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fileLogger := &lineLogger{}
+			global.FileLogger = fileLogger
+
+			tt.result.output()
+			if len(fileLogger.lines) != 1 {
+				t.Fatalf("写入 %d 行，期望 1 行", len(fileLogger.lines))
+			}
+
+			records, err := csv.NewReader(strings.NewReader(fileLogger.lines[0])).ReadAll()
+			if err != nil {
+				t.Fatalf("解析结果行 %q 错误: %v", fileLogger.lines[0], err)
+			}
+			if len(records) != 1 {
+				t.Fatalf("结果行 %q 解析为 %d 条记录，期望 1 条", fileLogger.lines[0], len(records))
+			}
+
+			record := records[0]
+			if len(record) != len(columns) {
+				t.Fatalf("结果行有 %d 列，期望 %d 列 (%s): %q", len(record), len(columns), Columns, record)
+			}
+
+			want := map[string]string{
+				"host":   tt.result.Host,
+				"status": tt.status,
+				"result": tt.detail,
+				"name":   tt.result.Name,
+				"ip":     tt.result.Addr,
+			}
+			for i, column := range columns {
+				if v, ok := want[column]; ok && record[i] != v {
+					t.Errorf("%s 列 = %q，期望 %q", column, record[i], v)
+				}
+			}
+		})
+	}
+}
+
+func TestJitter(t *testing.T) {
+	tests := []struct {
+		rtts []time.Duration
+		want time.Duration
+	}{
+		{rtts: nil, want: 0},
+		{rtts: []time.Duration{time.Millisecond}, want: 0},
+		{rtts: []time.Duration{10 * time.Millisecond, 14 * time.Millisecond, 12 * time.Millisecond}, want: 3 * time.Millisecond},
+	}
+	for _, tt := range tests {
+		if got := jitter(tt.rtts); got != tt.want {
+			t.Errorf("jitter(%v) = %v，期望 %v", tt.rtts, got, tt.want)
+		}
+	}
+}
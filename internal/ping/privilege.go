@@ -0,0 +1,24 @@
+package ping
+
+import "fmt"
+
+// Privileged 根据命令行选择确定 ping 是否使用特权模式（原始套接字），两者都未指定时自动检测
+// 自动检测时优先使用特权模式，没有权限时使用非特权模式（ICMP 数据报套接字），都不可用时返回说明缺少的权限或配置的错误
+func Privileged(privileged, unprivileged bool) (bool, error) {
+	switch {
+	case privileged:
+		return true, checkPrivileged()
+	case unprivileged:
+		return false, checkUnprivileged()
+	}
+
+	errPrivileged := checkPrivileged()
+	if errPrivileged == nil {
+		return true, nil
+	}
+	errUnprivileged := checkUnprivileged()
+	if errUnprivileged == nil {
+		return false, nil
+	}
+	return false, fmt.Errorf("无法创建 ICMP 套接字，%w；或者%w", errPrivileged, errUnprivileged)
+}
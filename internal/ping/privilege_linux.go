@@ -0,0 +1,40 @@
+//go:build linux
+
+package ping
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"syscall"
+)
+
+// checkPrivileged 检查能否创建 ICMP 原始套接字，需要 root 权限或 CAP_NET_RAW
+func checkPrivileged() error {
+	fd, err := syscall.Socket(syscall.AF_INET, syscall.SOCK_RAW, syscall.IPPROTO_ICMP)
+	if err != nil {
+		return fmt.Errorf("特权模式需要 root 权限或 CAP_NET_RAW 能力 (%w)", err)
+	}
+	_ = syscall.Close(fd)
+	return nil
+}
+
+// checkUnprivileged 检查能否创建 ICMP 数据报套接字，需要当前用户组在 net.ipv4.ping_group_range 范围内
+func checkUnprivileged() error {
+	fd, err := syscall.Socket(syscall.AF_INET, syscall.SOCK_DGRAM, syscall.IPPROTO_ICMP)
+	if err != nil {
+		return fmt.Errorf("非特权模式需要当前用户组 (gid %d) 在 net.ipv4.ping_group_range 范围内，当前为 %q，可以执行 sysctl -w net.ipv4.ping_group_range=\"0 2147483647\" 放开 (%w)",
+			os.Getgid(), pingGroupRange(), err)
+	}
+	_ = syscall.Close(fd)
+	return nil
+}
+
+// pingGroupRange 读取允许创建 ICMP 数据报套接字的用户组范围
+func pingGroupRange() string {
+	data, err := os.ReadFile("/proc/sys/net/ipv4/ping_group_range")
+	if err != nil {
+		return "未知"
+	}
+	return strings.Join(strings.Fields(string(data)), " ")
+}
@@ -0,0 +1,26 @@
+//go:build linux
+
+package ping
+
+import (
+	"strconv"
+	"strings"
+	"testing"
+)
+
+func TestPingGroupRange(t *testing.T) {
+	// 内核提供该配置时为两个用空格分隔的用户组 ID
+	got := pingGroupRange()
+	if got == "未知" {
+		t.Skip("当前环境没有 net.ipv4.ping_group_range")
+	}
+	fields := strings.Split(got, " ")
+	if len(fields) != 2 {
+		t.Fatalf("pingGroupRange() = %q，期望两个用户组 ID", got)
+	}
+	for _, field := range fields {
+		if _, err := strconv.ParseUint(field, 10, 32); err != nil {
+			t.Errorf("pingGroupRange() = %q 包含无效的用户组 ID: %v", got, err)
+		}
+	}
+}
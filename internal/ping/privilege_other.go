@@ -0,0 +1,21 @@
+//go:build !linux
+
+package ping
+
+import (
+	"errors"
+	"runtime"
+)
+
+// checkPrivileged 当前平台无法预先检查，权限不足时在 ping 时报错
+func checkPrivileged() error {
+	return nil
+}
+
+// checkUnprivileged Windows 只支持特权模式，其他平台在 ping 时报错
+func checkUnprivileged() error {
+	if runtime.GOOS == "windows" {
+		return errors.New("Windows 只支持特权模式")
+	}
+	return nil
+}
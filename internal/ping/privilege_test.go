@@ -0,0 +1,81 @@
+package ping
+
+import (
+	"context"
+	"io"
+	"log/slog"
+	"testing"
+	"time"
+
+	"github.com/ezra-sullivan/net-sniff/internal/global"
+)
+
+func TestPrivileged(t *testing.T) {
+	// 结果取决于运行环境的权限，按两种套接字的检查结果推算期望值
+	errPrivileged, errUnprivileged := checkPrivileged(), checkUnprivileged()
+
+	tests := []struct {
+		name         string
+		privileged   bool
+		unprivileged bool
+		want         bool
+		wantErr      bool
+	}{
+		{name: "指定特权模式", privileged: true, want: true, wantErr: errPrivileged != nil},
+		{name: "指定非特权模式", unprivileged: true, want: false, wantErr: errUnprivileged != nil},
+		{name: "自动检测", want: errPrivileged == nil, wantErr: errPrivileged != nil && errUnprivileged != nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := Privileged(tt.privileged, tt.unprivileged)
+			if got != tt.want || (err != nil) != tt.wantErr {
+				t.Errorf("Privileged(%v, %v) = %v, %v，期望 %v，错误 %v", tt.privileged, tt.unprivileged, got, err, tt.want, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestNewPinger(t *testing.T) {
+	tests := []struct {
+		name       string
+		addr       string
+		config     *Config
+		privileged bool
+		count      int
+		timeout    time.Duration
+	}{
+		{name: "没有配置时使用特权模式", addr: "127.0.0.1", config: nil, privileged: true, count: 1, timeout: time.Second},
+		{name: "非特权模式", addr: "127.0.0.1", config: &Config{Privileged: false}, privileged: false, count: 1, timeout: time.Second},
+		{name: "多包时超时加上发送间隔", addr: "::1", config: &Config{Count: 3, Interval: 200 * time.Millisecond, Privileged: true}, privileged: true, count: 3, timeout: 1400 * time.Millisecond},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			pinger, err := newPinger(tt.addr, time.Second, tt.config)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if pinger.Privileged() != tt.privileged || pinger.Count != tt.count || pinger.Timeout != tt.timeout {
+				t.Errorf("Privileged = %v，Count = %d，Timeout = %v，期望 %v, %d, %v",
+					pinger.Privileged(), pinger.Count, pinger.Timeout, tt.privileged, tt.count, tt.timeout)
+			}
+		})
+	}
+}
+
+func TestMultiPingLoopback(t *testing.T) {
+	global.ConsoleLogger = slog.New(slog.NewTextHandler(io.Discard, nil))
+
+	privileged, err := Privileged(false, false)
+	if err != nil {
+		t.Skipf("当前环境无法创建 ICMP 套接字: %v", err)
+	}
+
+	// 自动检测出的模式应能 ping 通本机
+	config := &Config{Count: 2, Interval: 10 * time.Millisecond, Privileged: privileged}
+	result := MultiPing(context.Background(), "127.0.0.1", time.Second, nil, config)
+	if !result.Success || result.PacketsSent != 2 || result.PacketsRecv == 0 {
+		t.Errorf("特权模式 %v 下 ping 127.0.0.1 = %+v", privileged, result)
+	}
+}
@@ -0,0 +1,105 @@
+package pscan
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net"
+	"strings"
+	"time"
+	"unicode"
+	"unicode/utf8"
+)
+
+// maxBannerSize 读取欢迎信息的最大字节数
+const maxBannerSize = 1024
+
+// BannerConfig TCP 端口开放后读取服务欢迎信息 (banner) 的配置
+type BannerConfig struct {
+	Probe   []byte        // 服务端没有主动发送欢迎信息时发送的探测数据，为空时只等待服务端发送
+	Timeout time.Duration // 每次读取的超时时间
+}
+
+// grabBanner 读取服务端主动发送的欢迎信息（如 SSH、SMTP、FTP、MySQL 握手包）
+// 超时未收到数据且配置了探测数据时，发送探测数据后再读取一次；上下文取消时立即结束
+// 返回清理后的欢迎信息（服务端没有响应或读取失败时为空字符串），greeted 表示服务端是否在发送探测数据前主动发送了数据
+func grabBanner(ctx context.Context, conn net.Conn, config *BannerConfig) (banner string, greeted bool) {
+	// 上下文取消时立即结束读写
+	stop := context.AfterFunc(ctx, func() {
+		_ = conn.SetDeadline(time.Now())
+	})
+	defer stop()
+
+	buff := make([]byte, maxBannerSize)
+	n, err := readBanner(ctx, conn, buff, config.Timeout)
+	greeted = n > 0
+	if n == 0 && isTimeout(err) && len(config.Probe) > 0 && ctx.Err() == nil {
+		// 读取超时后截止时间已过，发送前重新设置
+		if err = conn.SetDeadline(time.Now().Add(config.Timeout)); err != nil {
+			return "", false
+		}
+		if _, err = conn.Write(config.Probe); err != nil {
+			return "", false
+		}
+		n, _ = readBanner(ctx, conn, buff, config.Timeout)
+	}
+
+	return sanitizeBanner(buff[:n]), greeted
+}
+
+// readBanner 在超时时间内读取一次数据
+func readBanner(ctx context.Context, conn net.Conn, buff []byte, timeout time.Duration) (int, error) {
+	if err := conn.SetDeadline(time.Now().Add(timeout)); err != nil {
+		return 0, err
+	}
+	// 设置超时前上下文已取消时，AfterFunc 设置的截止时间已被覆盖
+	if err := ctx.Err(); err != nil {
+		return 0, err
+	}
+	return conn.Read(buff)
+}
+
+// isTimeout 判断是否为读写超时错误
+func isTimeout(err error) bool {
+	var netErr net.Error
+	return errors.As(err, &netErr) && netErr.Timeout()
+}
+
+// sanitizeBanner 将欢迎信息转换为单行可打印文本
+// 去掉末尾的空白，换行和制表符转换为 \r \n \t，其他不可打印字节和无效的 UTF-8 字节转换为 \xNN
+func sanitizeBanner(data []byte) string {
+	data = bytes.TrimRight(data, " \t\r\n\x00")
+
+	var b strings.Builder
+	for len(data) > 0 {
+		r, size := utf8.DecodeRune(data)
+		switch {
+		case r == '\r':
+			b.WriteString(`\r`)
+		case r == '\n':
+			b.WriteString(`\n`)
+		case r == '\t':
+			b.WriteString(`\t`)
+		case r == '\\':
+			b.WriteString(`\\`)
+		case r == utf8.RuneError && size == 1, !unicode.IsPrint(r):
+			for _, c := range data[:size] {
+				_, _ = fmt.Fprintf(&b, `\x%02x`, c)
+			}
+		default:
+			b.WriteRune(r)
+		}
+		data = data[size:]
+	}
+	return b.String()
+}
+
+// bannerAttr 返回用于日志输出的欢迎信息属性，欢迎信息为空时返回空属性（不会被输出）
+func bannerAttr(banner string) slog.Attr {
+	if banner == "" {
+		return slog.Attr{}
+	}
+	return slog.String("banner", banner)
+}
@@ -0,0 +1,105 @@
+package pscan
+
+import (
+	"context"
+	"io"
+	"net"
+	"testing"
+	"time"
+)
+
+func TestGrabBanner(t *testing.T) {
+	tests := []struct {
+		name        string
+		greeting    string // 服务端连接后主动发送的数据
+		reply       string // 服务端收到探测数据后发送的数据
+		probe       string
+		wantBanner  string
+		wantGreeted bool
+	}{
+		{name: "主动发送欢迎信息", greeting: "SSH-2.0-OpenSSH_8.9p1\r\n", wantBanner: "SSH-2.0-OpenSSH_8.9p1", wantGreeted: true},
+		{name: "主动发送时不发送探测数据", greeting: "220 ready\r\n", reply: "unexpected", probe: "HELP\r\n", wantBanner: "220 ready", wantGreeted: true},
+		{name: "没有欢迎信息也没有探测数据", reply: "unexpected"},
+		{name: "发送探测数据后读取响应", reply: "HTTP/1.0 200 OK\r\nServer: test\r\n\r\n", probe: "HEAD / HTTP/1.0\r\n\r\n", wantBanner: `HTTP/1.0 200 OK\r\nServer: test`},
+		{name: "探测数据没有响应", probe: "HEAD / HTTP/1.0\r\n\r\n"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			client, server := net.Pipe()
+			defer func() {
+				_ = client.Close()
+				_ = server.Close()
+			}()
+
+			go func() {
+				if tt.greeting != "" {
+					_, _ = server.Write([]byte(tt.greeting))
+				}
+				buff := make([]byte, 64)
+				if _, err := server.Read(buff); err == nil && tt.reply != "" {
+					_, _ = server.Write([]byte(tt.reply))
+				}
+			}()
+
+			config := &BannerConfig{Probe: []byte(tt.probe), Timeout: 50 * time.Millisecond}
+			banner, greeted := grabBanner(context.Background(), client, config)
+			if banner != tt.wantBanner || greeted != tt.wantGreeted {
+				t.Errorf("grabBanner = %q, %v，期望 %q, %v", banner, greeted, tt.wantBanner, tt.wantGreeted)
+			}
+		})
+	}
+}
+
+func TestGrabBannerCanceled(t *testing.T) {
+	client, server := net.Pipe()
+	defer func() {
+		_ = client.Close()
+		_ = server.Close()
+	}()
+	go func() {
+		_, _ = io.Copy(io.Discard, server)
+	}()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	time.AfterFunc(20*time.Millisecond, cancel)
+
+	start := time.Now()
+	config := &BannerConfig{Probe: []byte("ping"), Timeout: 5 * time.Second}
+	if banner, _ := grabBanner(ctx, client, config); banner != "" {
+		t.Errorf("grabBanner = %q，期望空字符串", banner)
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("上下文取消后 grabBanner 等待了 %v", elapsed)
+	}
+}
+
+func TestSanitizeBanner(t *testing.T) {
+	tests := []struct {
+		in   string
+		want string
+	}{
+		{in: "SSH-2.0-OpenSSH_8.9p1\r\n", want: "SSH-2.0-OpenSSH_8.9p1"},
+		{in: "220 a\r\n220 b\r\n", want: `220 a\r\n220 b`},
+		{in: "a\tb\\c", want: `a\tb\\c`},
+		{in: "\x0a\x00\x00\x00\x0a5.7.42\x00", want: `\n\x00\x00\x00\n5.7.42`},
+		{in: "bad \xff\xfe utf8", want: `bad \xff\xfe utf8`},
+		{in: "中文欢迎", want: "中文欢迎"},
+		{in: "\x1b[0m", want: `\x1b[0m`},
+		{in: " \r\n\x00", want: ""},
+	}
+	for _, tt := range tests {
+		if got := sanitizeBanner([]byte(tt.in)); got != tt.want {
+			t.Errorf("sanitizeBanner(%q) = %q，期望 %q", tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestBannerAttr(t *testing.T) {
+	if attr := bannerAttr(""); attr.Key != "" {
+		t.Errorf("bannerAttr(\"\") = %v，期望空属性", attr)
+	}
+	if attr := bannerAttr("SSH-2.0"); attr.Key != "banner" || attr.Value.String() != "SSH-2.0" {
+		t.Errorf("bannerAttr = %v", attr)
+	}
+}
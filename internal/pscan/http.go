@@ -0,0 +1,189 @@
+package pscan
+
+import (
+	"context"
+	"crypto/tls"
+	"fmt"
+	"github.com/ezra-sullivan/net-sniff/internal/initialize/logger"
+	"html"
+	"io"
+	"log/slog"
+	"net"
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+const (
+	// maxHTTPBodySize 提取标题时最多读取的响应体字节数
+	maxHTTPBodySize = 64 * 1024
+	// maxTitleLength 标题的最大字符数
+	maxTitleLength = 256
+)
+
+// httpsPorts 优先使用 HTTPS 的端口
+var httpsPorts = map[int]bool{
+	443:  true,
+	4443: true,
+	8443: true,
+	9443: true,
+}
+
+// titlePattern 匹配 HTML 标题
+var titlePattern = regexp.MustCompile(`(?is)<title[^>]*>(.*?)</title>`)
+
+// HTTPConfig TCP 端口开放后发送 HTTP 请求的配置
+type HTTPConfig struct {
+	Timeout      time.Duration // 单个协议的请求（包括重定向）的总超时时间
+	MaxRedirects int           // 最多跟随的重定向次数，超过后记录最后一个重定向响应
+}
+
+// HTTPInfo HTTP 请求的最终响应摘要
+type HTTPInfo struct {
+	URL           string // 首次请求的 URL
+	FinalURL      string // 跟随重定向后最终响应的 URL
+	Redirects     int    // 跟随的重定向次数
+	StatusCode    int
+	Title         string // HTML 页面标题
+	Server        string // Server 响应头
+	ContentLength int64  // 响应体长度，未知时为 -1
+}
+
+// probeHTTP 向开放的端口发送 HTTP 和 HTTPS 请求，返回第一个成功的协议的响应摘要
+// 端口已完成 TLS 握手或为常用 HTTPS 端口时先尝试 HTTPS，否则先尝试 HTTP；host 用作请求的主机名，连接 address
+// 两种协议都没有响应时返回 nil
+func probeHTTP(ctx context.Context, host, address string, port int, isTLS bool, config *HTTPConfig) *HTTPInfo {
+	schemes := []string{"http", "https"}
+	if isTLS || httpsPorts[port] {
+		schemes = []string{"https", "http"}
+	}
+
+	var fallback *HTTPInfo
+	for _, scheme := range schemes {
+		if ctx.Err() != nil {
+			break
+		}
+		info := fetchHTTP(ctx, scheme, host, address, port, config)
+		// HTTPS 端口通常对明文请求返回 400，此时继续尝试 HTTPS，失败时再使用该响应
+		if info != nil && scheme == "http" && info.StatusCode == http.StatusBadRequest {
+			fallback = info
+			continue
+		}
+		if info != nil {
+			return info
+		}
+	}
+	return fallback
+}
+
+// fetchHTTP 使用指定协议请求根路径并跟随重定向，请求失败时返回 nil
+func fetchHTTP(ctx context.Context, scheme, host, address string, port int, config *HTTPConfig) *HTTPInfo {
+	ctx, cancel := context.WithTimeout(ctx, config.Timeout)
+	defer cancel()
+
+	// 首个请求的主机连接已探测的地址，重定向到其他主机时正常解析
+	origin := net.JoinHostPort(host, strconv.Itoa(port))
+	dialer := net.Dialer{Timeout: config.Timeout}
+	transport := &http.Transport{
+		DialContext: func(ctx context.Context, network, addr string) (net.Conn, error) {
+			if addr == origin {
+				addr = address
+			}
+			return dialer.DialContext(ctx, network, addr)
+		},
+		// 只记录响应，不校验证书
+		TLSClientConfig:   &tls.Config{InsecureSkipVerify: true},
+		DisableKeepAlives: true,
+	}
+	defer transport.CloseIdleConnections()
+
+	redirects := 0
+	client := &http.Client{
+		Transport: transport,
+		CheckRedirect: func(req *http.Request, via []*http.Request) error {
+			if len(via) > config.MaxRedirects {
+				return http.ErrUseLastResponse
+			}
+			redirects++
+			return nil
+		},
+	}
+
+	url := scheme + "://" + origin + "/"
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return nil
+	}
+	req.Header.Set("User-Agent", "net-sniff")
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil
+	}
+	defer func() {
+		_ = resp.Body.Close()
+	}()
+
+	info := &HTTPInfo{
+		URL:           url,
+		FinalURL:      resp.Request.URL.String(),
+		Redirects:     redirects,
+		StatusCode:    resp.StatusCode,
+		Server:        resp.Header.Get("Server"),
+		ContentLength: resp.ContentLength,
+	}
+
+	// 读取响应体开头提取标题，没有 Content-Length 且响应体完整读取时记录实际长度
+	body, err := io.ReadAll(io.LimitReader(resp.Body, maxHTTPBodySize+1))
+	if info.ContentLength < 0 && err == nil && len(body) <= maxHTTPBodySize {
+		info.ContentLength = int64(len(body))
+	}
+	info.Title = extractTitle(body)
+
+	return info
+}
+
+// extractTitle 提取 HTML 标题，解码实体并合并空白，没有标题时返回空字符串
+func extractTitle(body []byte) string {
+	m := titlePattern.FindSubmatch(body)
+	if m == nil {
+		return ""
+	}
+
+	title := strings.Join(strings.Fields(html.UnescapeString(string(m[1]))), " ")
+	if utf8.RuneCountInString(title) > maxTitleLength {
+		title = string([]rune(title)[:maxTitleLength])
+	}
+	return sanitizeBanner([]byte(title))
+}
+
+// httpAttr 返回用于日志输出的 HTTP 属性，未请求或没有响应时返回空属性（不会被输出）
+func httpAttr(info *HTTPInfo) slog.Attr {
+	if info == nil {
+		return slog.Attr{}
+	}
+
+	attrs := []any{
+		"status", info.StatusCode,
+		"title", info.Title,
+		"server", info.Server,
+		"length", info.ContentLength,
+		"url", info.FinalURL,
+	}
+	if info.Redirects > 0 {
+		attrs = append(attrs, "redirects", info.Redirects)
+	}
+	return slog.Group("http", attrs...)
+}
+
+// httpFields 返回 CSV 中的 HTTP 列：状态码、标题、Server、响应体长度、最终 URL
+func httpFields(info *HTTPInfo) string {
+	if info == nil {
+		return ",,,,"
+	}
+	return fmt.Sprintf("%d,%s,%s,%d,%s", info.StatusCode, logger.CSVField(info.Title), logger.CSVField(info.Server),
+		info.ContentLength, logger.CSVField(info.FinalURL))
+}
@@ -0,0 +1,156 @@
+package pscan
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+)
+
+// testHandler 根路径依次重定向到 /a 和 /b，/b 返回带标题的页面
+func testHandler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Server", "test-server")
+		switch r.URL.Path {
+		case "/":
+			http.Redirect(w, r, "/a", http.StatusFound)
+		case "/a":
+			http.Redirect(w, r, "/b", http.StatusMovedPermanently)
+		case "/b":
+			_, _ = fmt.Fprint(w, "<html><head><title>\n  Test &amp; Page\n</title></head></html>")
+		default:
+			http.NotFound(w, r)
+		}
+	})
+	return mux
+}
+
+// serverAddr 返回测试服务器的监听地址和端口
+func serverAddr(t *testing.T, server *httptest.Server) (string, int) {
+	t.Helper()
+	address := server.Listener.Addr().String()
+	_, portStr, err := net.SplitHostPort(address)
+	if err != nil {
+		t.Fatal(err)
+	}
+	port, err := strconv.Atoi(portStr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return address, port
+}
+
+func TestProbeHTTP(t *testing.T) {
+	httpServer := httptest.NewServer(testHandler())
+	defer httpServer.Close()
+
+	// TLS 服务器收到明文请求时返回 400，关闭其错误日志
+	tlsServer := httptest.NewUnstartedServer(testHandler())
+	tlsServer.Config.ErrorLog = log.New(io.Discard, "", 0)
+	tlsServer.StartTLS()
+	defer tlsServer.Close()
+
+	// 主机名 web.test 无法解析，只有连接被改写到测试服务器时请求才能成功
+	const host = "web.test"
+
+	tests := []struct {
+		name         string
+		server       *httptest.Server
+		isTLS        bool
+		maxRedirects int
+		scheme       string // 期望使用的协议
+		status       int
+		redirects    int
+		finalPath    string
+		title        string
+	}{
+		{name: "跟随重定向", server: httpServer, maxRedirects: 5, scheme: "http", status: http.StatusOK, redirects: 2, finalPath: "/b", title: "Test & Page"},
+		{name: "超过重定向次数", server: httpServer, maxRedirects: 1, scheme: "http", status: http.StatusMovedPermanently, redirects: 1, finalPath: "/a"},
+		{name: "不跟随重定向", server: httpServer, maxRedirects: 0, scheme: "http", status: http.StatusFound, redirects: 0, finalPath: "/"},
+		{name: "已完成 TLS 握手", server: tlsServer, isTLS: true, maxRedirects: 5, scheme: "https", status: http.StatusOK, redirects: 2, finalPath: "/b", title: "Test & Page"},
+		{name: "明文请求返回 400 后尝试 HTTPS", server: tlsServer, maxRedirects: 5, scheme: "https", status: http.StatusOK, redirects: 2, finalPath: "/b", title: "Test & Page"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			address, port := serverAddr(t, tt.server)
+			config := &HTTPConfig{Timeout: 5 * time.Second, MaxRedirects: tt.maxRedirects}
+
+			info := probeHTTP(context.Background(), host, address, port, tt.isTLS, config)
+			if info == nil {
+				t.Fatal("probeHTTP 返回 nil")
+			}
+
+			origin := tt.scheme + "://" + net.JoinHostPort(host, strconv.Itoa(port))
+			if info.URL != origin+"/" {
+				t.Errorf("URL = %q，期望 %q", info.URL, origin+"/")
+			}
+			if info.FinalURL != origin+tt.finalPath {
+				t.Errorf("FinalURL = %q，期望 %q", info.FinalURL, origin+tt.finalPath)
+			}
+			if info.StatusCode != tt.status {
+				t.Errorf("StatusCode = %d，期望 %d", info.StatusCode, tt.status)
+			}
+			if info.Redirects != tt.redirects {
+				t.Errorf("Redirects = %d，期望 %d", info.Redirects, tt.redirects)
+			}
+			if info.Title != tt.title {
+				t.Errorf("Title = %q，期望 %q", info.Title, tt.title)
+			}
+			if info.Server != "test-server" {
+				t.Errorf("Server = %q，期望 %q", info.Server, "test-server")
+			}
+		})
+	}
+}
+
+func TestProbeHTTPNoResponse(t *testing.T) {
+	// 只接受连接、不返回任何数据的端口
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		_ = listener.Close()
+	}()
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			_ = conn.Close()
+		}
+	}()
+
+	address := listener.Addr().String()
+	port := listener.Addr().(*net.TCPAddr).Port
+	config := &HTTPConfig{Timeout: 2 * time.Second, MaxRedirects: 5}
+	if info := probeHTTP(context.Background(), "127.0.0.1", address, port, false, config); info != nil {
+		t.Errorf("probeHTTP = %+v，期望 nil", info)
+	}
+}
+
+func TestExtractTitle(t *testing.T) {
+	tests := []struct {
+		body string
+		want string
+	}{
+		{body: "<title>Hello</title>", want: "Hello"},
+		{body: "<TITLE lang=\"en\">\n A \t B \n</TITLE>", want: "A B"},
+		{body: "<title>&lt;x&gt; &amp; y</title>", want: "<x> & y"},
+		{body: "<html><body>no title</body></html>", want: ""},
+	}
+	for _, tt := range tests {
+		if got := extractTitle([]byte(tt.body)); got != tt.want {
+			t.Errorf("extractTitle(%q) = %q，期望 %q", tt.body, got, tt.want)
+		}
+	}
+}
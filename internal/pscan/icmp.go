@@ -0,0 +1,156 @@
+package pscan
+
+import (
+	"encoding/binary"
+	"errors"
+	"github.com/ezra-sullivan/net-sniff/internal/global"
+	"net"
+	"net/netip"
+	"sync"
+	"syscall"
+	"time"
+)
+
+const (
+	icmpTypeUnreachable     = 3
+	icmpCodePortUnreachable = 3
+)
+
+// ICMPListener 使用原始套接字监听 ICMP 目标不可达消息，用于判断 UDP 端口的状态，只支持 IPv4
+// 端口不可达说明端口关闭，其他不可达（主机、网络、协议不可达或被管理策略禁止）说明端口被过滤
+// 可以被多个协程并发使用
+type ICMPListener struct {
+	conn *net.IPConn
+
+	mu      sync.Mutex
+	pending map[icmpKey]*icmpWatch
+}
+
+// icmpKey 用于将 ICMP 消息与 UDP 探测对应：目标地址、目标端口、本地端口
+type icmpKey struct {
+	addr       netip.Addr
+	port       uint16
+	sourcePort uint16
+}
+
+// icmpWatch 等待 ICMP 消息的 UDP 探测
+type icmpWatch struct {
+	conn  net.Conn
+	state chan uint8
+}
+
+// ListenICMP 创建 ICMP 不可达监听器，需要 root 权限或 CAP_NET_RAW，使用完毕后需要调用 Close
+func ListenICMP() (*ICMPListener, error) {
+	conn, err := net.ListenIP("ip4:icmp", nil)
+	if err != nil {
+		return nil, err
+	}
+
+	l := &ICMPListener{
+		conn:    conn,
+		pending: make(map[icmpKey]*icmpWatch),
+	}
+	go l.receive()
+	return l, nil
+}
+
+// ListenICMPIfPrivileged 有权限时创建 ICMP 不可达监听器，没有权限时返回 nil，此时只根据套接字错误判断端口状态
+func ListenICMPIfPrivileged() *ICMPListener {
+	l, err := ListenICMP()
+	if err != nil {
+		global.ConsoleLogger.Debug("无法监听 ICMP 不可达消息，只根据套接字错误判断 UDP 端口状态", "error", err)
+		return nil
+	}
+	return l
+}
+
+// Close 关闭原始套接字
+func (l *ICMPListener) Close() error {
+	return l.conn.Close()
+}
+
+// watch 登记通过 conn 发送的 UDP 探测，收到对应的 ICMP 不可达消息时将端口状态发送到返回的通道，并立即结束 conn 的读取
+// 返回的函数用于取消登记；非 IPv4 目标不会收到消息
+func (l *ICMPListener) watch(conn net.Conn, addr string, port int) (<-chan uint8, func()) {
+	state := make(chan uint8, 1)
+
+	dst, err1 := netip.ParseAddr(addr)
+	local, err2 := netip.ParseAddrPort(conn.LocalAddr().String())
+	if err1 != nil || err2 != nil || !dst.Unmap().Is4() {
+		return state, func() {}
+	}
+
+	key := icmpKey{addr: dst.Unmap(), port: uint16(port), sourcePort: local.Port()}
+	l.mu.Lock()
+	l.pending[key] = &icmpWatch{conn: conn, state: state}
+	l.mu.Unlock()
+
+	return state, func() {
+		l.mu.Lock()
+		delete(l.pending, key)
+		l.mu.Unlock()
+	}
+}
+
+// receive 读取 ICMP 目标不可达消息，交给对应的 UDP 探测，套接字关闭后退出
+func (l *ICMPListener) receive() {
+	buff := make([]byte, 1500)
+	for {
+		// IPv4 原始套接字读取时已去掉外层 IP 头
+		n, _, err := l.conn.ReadFromIP(buff)
+		if err != nil {
+			if errors.Is(err, net.ErrClosed) {
+				return
+			}
+			continue
+		}
+
+		key, code, ok := parseUnreachable(buff[:n])
+		if !ok {
+			continue
+		}
+
+		l.mu.Lock()
+		w := l.pending[key]
+		l.mu.Unlock()
+		if w == nil {
+			continue
+		}
+
+		select {
+		case w.state <- unreachableState(code):
+			_ = w.conn.SetReadDeadline(time.Now())
+		default:
+		}
+	}
+}
+
+// parseUnreachable 解析 ICMP 目标不可达消息中引用的原始 UDP 包，返回探测的标识和不可达代码
+func parseUnreachable(msg []byte) (icmpKey, uint8, bool) {
+	// ICMP 头 8 字节，之后是原始 IP 头和 UDP 头的前 8 字节
+	if len(msg) < 8+20+8 || msg[0] != icmpTypeUnreachable {
+		return icmpKey{}, 0, false
+	}
+
+	original := msg[8:]
+	headerLen := int(original[0]&0x0f) * 4
+	if original[0]>>4 != 4 || original[9] != syscall.IPPROTO_UDP || headerLen < 20 || len(original) < headerLen+8 {
+		return icmpKey{}, 0, false
+	}
+
+	udp := original[headerLen:]
+	key := icmpKey{
+		addr:       netip.AddrFrom4([4]byte(original[16:20])),
+		port:       binary.BigEndian.Uint16(udp[2:4]),
+		sourcePort: binary.BigEndian.Uint16(udp[0:2]),
+	}
+	return key, msg[1], true
+}
+
+// unreachableState 根据目标不可达代码判断端口状态：端口不可达时端口关闭，其他不可达时端口被过滤
+func unreachableState(code uint8) uint8 {
+	if code == icmpCodePortUnreachable {
+		return UDP_PORT_CLOSED
+	}
+	return UDP_PORT_FILTERED
+}
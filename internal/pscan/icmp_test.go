@@ -0,0 +1,122 @@
+package pscan
+
+import (
+	"encoding/binary"
+	"net"
+	"net/netip"
+	"testing"
+)
+
+// unreachableMessage 构造 ICMP 目标不可达消息：ICMP 头 + 原始 IPv4 头 + 原始 UDP 头的前 8 字节
+func unreachableMessage(typ, code uint8, dst netip.Addr, sourcePort, port uint16) []byte {
+	msg := make([]byte, 8+20+8)
+	msg[0], msg[1] = typ, code
+
+	ip := msg[8:28]
+	ip[0] = 4<<4 | 5 // IPv4，首部长度 5 个 32 位字
+	ip[8] = 64
+	ip[9] = 17 // UDP
+	copy(ip[12:16], []byte{192, 0, 2, 100})
+	dst4 := dst.As4()
+	copy(ip[16:20], dst4[:])
+
+	udp := msg[28:]
+	binary.BigEndian.PutUint16(udp[0:2], sourcePort)
+	binary.BigEndian.PutUint16(udp[2:4], port)
+	return msg
+}
+
+func TestParseUnreachable(t *testing.T) {
+	dst := netip.MustParseAddr("192.0.2.1")
+	valid := unreachableMessage(icmpTypeUnreachable, icmpCodePortUnreachable, dst, 50000, 161)
+
+	// 原始 IP 头带 4 字节选项
+	withOptions := make([]byte, 0, len(valid)+4)
+	withOptions = append(withOptions, valid[:8+20]...)
+	withOptions = append(withOptions, 0, 0, 0, 0)
+	withOptions = append(withOptions, valid[8+20:]...)
+	withOptions[8] = 4<<4 | 6
+
+	// 原始包不是 UDP
+	notUDP := unreachableMessage(icmpTypeUnreachable, icmpCodePortUnreachable, dst, 50000, 161)
+	notUDP[8+9] = 6
+
+	// 原始包不是 IPv4
+	notIPv4 := unreachableMessage(icmpTypeUnreachable, icmpCodePortUnreachable, dst, 50000, 161)
+	notIPv4[8] = 6<<4 | 5
+
+	tests := []struct {
+		name  string
+		msg   []byte
+		ok    bool
+		state uint8
+	}{
+		{name: "端口不可达 (3/3)", msg: valid, ok: true, state: UDP_PORT_CLOSED},
+		{name: "被管理策略禁止 (3/13)", msg: unreachableMessage(icmpTypeUnreachable, 13, dst, 50000, 161), ok: true, state: UDP_PORT_FILTERED},
+		{name: "主机不可达 (3/1)", msg: unreachableMessage(icmpTypeUnreachable, 1, dst, 50000, 161), ok: true, state: UDP_PORT_FILTERED},
+		{name: "原始 IP 头带选项", msg: withOptions, ok: true, state: UDP_PORT_CLOSED},
+		{name: "回显应答不是不可达消息", msg: unreachableMessage(0, 0, dst, 50000, 161)},
+		{name: "超时消息不是不可达消息", msg: unreachableMessage(11, 0, dst, 50000, 161)},
+		{name: "截断的 UDP 头", msg: valid[:len(valid)-1]},
+		{name: "截断的 IP 头", msg: valid[:8+19]},
+		{name: "只有 ICMP 头", msg: valid[:8]},
+		{name: "带选项的 IP 头截断了 UDP 头", msg: withOptions[:len(withOptions)-1]},
+		{name: "原始包不是 UDP", msg: notUDP},
+		{name: "原始包不是 IPv4", msg: notIPv4},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			key, code, ok := parseUnreachable(tt.msg)
+			if ok != tt.ok {
+				t.Fatalf("parseUnreachable ok = %v，期望 %v", ok, tt.ok)
+			}
+			if !ok {
+				return
+			}
+
+			want := icmpKey{addr: dst, port: 161, sourcePort: 50000}
+			if key != want {
+				t.Errorf("key = %+v，期望 %+v", key, want)
+			}
+			if got := unreachableState(code); got != tt.state {
+				t.Errorf("代码 %d 的端口状态 = %d，期望 %d", code, got, tt.state)
+			}
+		})
+	}
+}
+
+func TestICMPListenerWatchKey(t *testing.T) {
+	// 不创建原始套接字，只检查登记的 key 与不可达消息解析出的 key 一致
+	l := &ICMPListener{pending: make(map[icmpKey]*icmpWatch)}
+
+	conn, err := net.Dial("udp4", "127.0.0.1:161")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		_ = conn.Close()
+	}()
+	sourcePort := uint16(conn.LocalAddr().(*net.UDPAddr).Port)
+
+	_, cancel := l.watch(conn, "::ffff:127.0.0.1", 161)
+	key, _, ok := parseUnreachable(unreachableMessage(icmpTypeUnreachable, icmpCodePortUnreachable, netip.MustParseAddr("127.0.0.1"), sourcePort, 161))
+	if !ok {
+		t.Fatal("parseUnreachable 解析失败")
+	}
+	if l.pending[key] == nil {
+		t.Errorf("没有找到 key %+v 对应的探测，已登记 %v", key, l.pending)
+	}
+
+	cancel()
+	if len(l.pending) != 0 {
+		t.Errorf("取消登记后仍有 %d 个探测", len(l.pending))
+	}
+
+	// IPv6 目标不登记
+	if _, cancel := l.watch(conn, "::1", 161); len(l.pending) != 0 {
+		t.Errorf("IPv6 目标不应登记")
+	} else {
+		cancel()
+	}
+}
@@ -0,0 +1,62 @@
+package pscan
+
+import (
+	"context"
+	"net"
+)
+
+// TCPProbes TCP 端口开放后执行的附加探测，为 nil 的字段表示不执行对应的探测
+type TCPProbes struct {
+	Banner  *BannerConfig  // 读取服务的欢迎信息
+	Service *ServiceConfig // 识别服务和版本
+	TLS     *TLSConfig     // 检查 TLS 证书和协议
+	HTTP    *HTTPConfig    // 发送 HTTP/HTTPS 请求
+}
+
+// run 对开放的端口依次执行附加探测并把结果写入 result
+// 扫描建立的连接 conn 只交给第一个探测使用，之后的探测各自建立新连接并最长等待各自的超时时间，
+// 因此根据之前探测的结果跳过不适用的探测：服务端主动发送了数据或识别出其他服务时不检查直接 TLS、不发送 HTTP 请求
+func (p *TCPProbes) run(ctx context.Context, conn net.Conn, address string, result *TCPScanResult) {
+	// greeted 表示服务端主动发送了欢迎信息
+	greeted := false
+	if p.Banner != nil {
+		result.Banner, greeted = grabBanner(ctx, conn, p.Banner)
+		conn = nil
+	}
+
+	if p.Service != nil {
+		// 已确认服务端不会主动发送数据时，NULL 探测不会有响应
+		if info, ok := detectTCP(ctx, conn, address, result.Port, p.Banner != nil && !greeted, p.Service); ok {
+			result.Service, result.Product, result.Version = info.Service, info.Product, info.Version
+		}
+		conn = nil
+	}
+
+	// 识别出的服务名用于选择 STARTTLS 协议
+	if p.TLS != nil && result.tlsApplies(greeted) {
+		result.TLS = inspectTLS(ctx, conn, result.Host, address, result.Port, result.Service, p.TLS)
+		result.warnExpiry(p.TLS.WarnDays)
+	}
+
+	// TLS 握手成功时先尝试 HTTPS
+	if p.HTTP != nil && result.httpApplies(greeted) {
+		result.HTTP = probeHTTP(ctx, result.Host, address, result.Port, result.TLS != nil, p.HTTP)
+	}
+}
+
+// tlsApplies 判断是否需要检查 TLS：服务使用 STARTTLS，或服务端没有主动发送数据且未识别出 HTTPS 以外的服务
+// 直接 TLS 由客户端先发送握手，主动发送欢迎信息或识别为明文服务 (如 ssh、http) 的端口不会是直接 TLS
+func (result *TCPScanResult) tlsApplies(greeted bool) bool {
+	if startTLSProtocol(result.Service, result.Port) != "" {
+		return true
+	}
+	return !greeted && (result.Service == "" || result.Service == "https")
+}
+
+// httpApplies 判断是否需要发送 HTTP 请求：直接 TLS 握手成功，或服务端没有主动发送数据且未识别出 HTTP 以外的服务
+func (result *TCPScanResult) httpApplies(greeted bool) bool {
+	if result.TLS != nil && result.TLS.StartTLS == "" {
+		return true
+	}
+	return !greeted && (result.Service == "" || result.Service == "http" || result.Service == "https")
+}
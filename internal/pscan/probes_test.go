@@ -0,0 +1,107 @@
+package pscan
+
+import (
+	"context"
+	"net"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/ezra-sullivan/net-sniff/internal/service"
+)
+
+func TestTCPProbesApplies(t *testing.T) {
+	tests := []struct {
+		name     string
+		result   TCPScanResult
+		greeted  bool
+		wantTLS  bool
+		wantHTTP bool
+	}{
+		{name: "没有欢迎信息的未知服务", result: TCPScanResult{Port: 8443}, wantTLS: true, wantHTTP: true},
+		{name: "主动发送欢迎信息的未知服务", result: TCPScanResult{Port: 2222}, greeted: true},
+		{name: "识别为 ssh", result: TCPScanResult{Port: 22, Service: "ssh"}, greeted: true},
+		{name: "识别为 http", result: TCPScanResult{Port: 80, Service: "http"}, wantTLS: false, wantHTTP: true},
+		{name: "识别为 https", result: TCPScanResult{Port: 443, Service: "https"}, wantTLS: true, wantHTTP: true},
+		{name: "识别为 mysql", result: TCPScanResult{Port: 3306, Service: "mysql"}, greeted: true},
+		{name: "识别为 smtp 时使用 STARTTLS", result: TCPScanResult{Port: 2525, Service: "smtp"}, greeted: true, wantTLS: true},
+		{name: "STARTTLS 端口", result: TCPScanResult{Port: 587}, greeted: true, wantTLS: true},
+		{name: "直接 TLS 握手成功", result: TCPScanResult{Port: 8443, TLS: &TLSInfo{}}, greeted: true, wantTLS: false, wantHTTP: true},
+		{name: "STARTTLS 握手成功", result: TCPScanResult{Port: 25, Service: "smtp", TLS: &TLSInfo{StartTLS: "smtp"}}, greeted: true, wantTLS: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// TLS 检查在 HTTP 探测之前，判断 TLS 时结果中还没有握手信息
+			if tt.result.TLS == nil {
+				if got := tt.result.tlsApplies(tt.greeted); got != tt.wantTLS {
+					t.Errorf("tlsApplies(%v) = %v，期望 %v", tt.greeted, got, tt.wantTLS)
+				}
+			}
+			if got := tt.result.httpApplies(tt.greeted); got != tt.wantHTTP {
+				t.Errorf("httpApplies(%v) = %v，期望 %v", tt.greeted, got, tt.wantHTTP)
+			}
+		})
+	}
+}
+
+func TestTCPProbesRunSkips(t *testing.T) {
+	// 模拟 SSH 服务：连接后立即发送欢迎信息，之后不再响应
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		_ = listener.Close()
+	}()
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			_, _ = conn.Write([]byte("SSH-2.0-OpenSSH_8.9p1 Ubuntu-3\r\n"))
+			time.AfterFunc(5*time.Second, func() {
+				_ = conn.Close()
+			})
+		}
+	}()
+
+	db, err := service.New("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	const timeout = 2 * time.Second
+	probes := &TCPProbes{
+		Banner:  &BannerConfig{Timeout: timeout},
+		Service: &ServiceConfig{Database: db, Timeout: timeout},
+		TLS:     &TLSConfig{Timeout: timeout},
+		HTTP:    &HTTPConfig{Timeout: timeout},
+	}
+
+	address := listener.Addr().String()
+	conn, err := net.Dial("tcp", address)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		_ = conn.Close()
+	}()
+	_, portStr, _ := net.SplitHostPort(address)
+	port, _ := strconv.Atoi(portStr)
+
+	result := &TCPScanResult{Host: "127.0.0.1", Port: port, IsOpen: true}
+	start := time.Now()
+	probes.run(context.Background(), conn, address, result)
+
+	// 识别出 ssh 后跳过 TLS 检查和 HTTP 请求，不会等待它们的超时
+	if elapsed := time.Since(start); elapsed >= timeout {
+		t.Errorf("附加探测耗时 %v，不适用的探测没有跳过", elapsed)
+	}
+	if result.Banner == "" || result.Service != "ssh" {
+		t.Errorf("Banner = %q，Service = %q，期望识别为 ssh", result.Banner, result.Service)
+	}
+	if result.TLS != nil || result.HTTP != nil {
+		t.Errorf("TLS = %+v，HTTP = %+v，期望跳过", result.TLS, result.HTTP)
+	}
+}
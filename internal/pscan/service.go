@@ -0,0 +1,103 @@
+package pscan
+
+import (
+	"context"
+	"github.com/ezra-sullivan/net-sniff/internal/service"
+	"log/slog"
+	"net"
+	"time"
+)
+
+// ServiceConfig 服务与版本识别的配置
+type ServiceConfig struct {
+	Database *service.Database
+	Timeout  time.Duration // 每个探测的读取超时时间
+}
+
+// detectTCP 依次执行适用于端口的 TCP 探测，返回第一个匹配的结果
+// conn 不为 nil 时 NULL 探测复用该连接，其余探测各自建立新连接；上下文取消时立即结束
+// skipNull 为 true 时已确认服务端不会主动发送数据，跳过只读取欢迎信息的 NULL 探测
+func detectTCP(ctx context.Context, conn net.Conn, address string, port int, skipNull bool, config *ServiceConfig) (service.Info, bool) {
+	dialer := net.Dialer{Timeout: config.Timeout}
+	for _, probe := range config.Database.Probes("tcp", port) {
+		if ctx.Err() != nil {
+			break
+		}
+		if skipNull && len(probe.Payload) == 0 {
+			continue
+		}
+
+		// 只有 NULL 探测可以复用扫描时建立的连接
+		c, owned := conn, false
+		conn = nil
+		if c == nil || len(probe.Payload) > 0 {
+			var err error
+			if c, err = dialer.DialContext(ctx, "tcp", address); err != nil {
+				continue
+			}
+			owned = true
+		}
+
+		response := exchange(ctx, c, probe.Payload, config.Timeout)
+		if owned {
+			_ = c.Close()
+		}
+
+		if info, ok := config.Database.Match(probe, response); ok {
+			return info, true
+		}
+	}
+	return service.Info{}, false
+}
+
+// detectUDP 依次执行适用于端口的 UDP 探测，返回第一个匹配的结果
+func detectUDP(ctx context.Context, address string, port int, config *ServiceConfig) (service.Info, bool) {
+	dialer := net.Dialer{Timeout: config.Timeout}
+	for _, probe := range config.Database.Probes("udp", port) {
+		if ctx.Err() != nil {
+			break
+		}
+
+		c, err := dialer.DialContext(ctx, "udp", address)
+		if err != nil {
+			continue
+		}
+		response := exchange(ctx, c, probe.Payload, config.Timeout)
+		_ = c.Close()
+
+		if info, ok := config.Database.Match(probe, response); ok {
+			return info, true
+		}
+	}
+	return service.Info{}, false
+}
+
+// exchange 发送载荷（为空时不发送）并在超时时间内读取一次响应
+func exchange(ctx context.Context, conn net.Conn, payload []byte, timeout time.Duration) []byte {
+	// 上下文取消时立即结束读写
+	stop := context.AfterFunc(ctx, func() {
+		_ = conn.SetDeadline(time.Now())
+	})
+	defer stop()
+
+	buff := make([]byte, maxBannerSize)
+	if err := conn.SetDeadline(time.Now().Add(timeout)); err != nil || ctx.Err() != nil {
+		return nil
+	}
+	if len(payload) > 0 {
+		if _, err := conn.Write(payload); err != nil {
+			return nil
+		}
+	}
+
+	n, _ := conn.Read(buff)
+	return buff[:n]
+}
+
+// serviceAttr 返回用于日志输出的服务识别属性，未识别时返回空属性（不会被输出）
+func serviceAttr(name, product, version string) slog.Attr {
+	if name == "" {
+		return slog.Attr{}
+	}
+	return slog.String("service", service.Info{Service: name, Product: product, Version: version}.String())
+}
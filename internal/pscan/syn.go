@@ -0,0 +1,35 @@
+package pscan
+
+import (
+	"fmt"
+	"github.com/ezra-sullivan/net-sniff/internal/global"
+)
+
+// TCP 扫描模式
+const (
+	ModeConnect = "connect" // 建立完整的 TCP 连接
+	ModeSYN     = "syn"     // 只发送 SYN 包的半开放扫描，需要 Linux 和 root 权限
+)
+
+// CheckMode 检查扫描模式是否有效
+func CheckMode(mode string) error {
+	if mode != ModeConnect && mode != ModeSYN {
+		return fmt.Errorf("不支持的扫描模式: %s (可选 %s、%s)", mode, ModeConnect, ModeSYN)
+	}
+	return nil
+}
+
+// NewScannerForMode 扫描模式为 syn 时创建 SYN 扫描器
+// 无法创建时（非 Linux、没有 root 权限或 CAP_NET_RAW）输出警告并返回 nil，此时使用 connect 扫描
+func NewScannerForMode(mode string) *SYNScanner {
+	if mode != ModeSYN {
+		return nil
+	}
+
+	syn, err := NewSYNScanner()
+	if err != nil {
+		global.ConsoleLogger.Warn("无法使用 SYN 扫描，改用 connect 扫描", "error", err)
+		return nil
+	}
+	return syn
+}
@@ -0,0 +1,269 @@
+//go:build linux
+
+package pscan
+
+import (
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math/rand/v2"
+	"net"
+	"net/netip"
+	"os"
+	"sync"
+	"sync/atomic"
+	"syscall"
+	"time"
+)
+
+const (
+	// synPortBase、synPortRange 发送 SYN 包使用的本地端口范围
+	synPortBase  = 40000
+	synPortRange = 20000
+
+	tcpFlagSYN = 0x02
+	tcpFlagRST = 0x04
+	tcpFlagACK = 0x10
+)
+
+// SYNScanner 使用原始套接字发送 SYN 包的半开放扫描器，只支持 IPv4
+// 收到 SYN/ACK 时端口开放（内核会自动回复 RST，不会建立完整连接），收到 RST 时端口关闭，超时无响应时端口被过滤
+// 可以被多个协程并发使用
+type SYNScanner struct {
+	conn    *net.IPConn
+	counter atomic.Uint32
+
+	mu      sync.Mutex
+	pending map[synKey]*synProbe
+
+	sources sync.Map // 目标地址 -> 本地地址
+}
+
+// synKey 用于将响应与探测对应：目标地址、目标端口、本地端口
+type synKey struct {
+	addr       netip.Addr
+	port       uint16
+	sourcePort uint16
+}
+
+// synProbe 等待响应的探测
+type synProbe struct {
+	seq   uint32
+	reply chan byte // 响应的 TCP 标志
+}
+
+// NewSYNScanner 创建 SYN 扫描器，需要 root 权限或 CAP_NET_RAW
+// 使用完毕后需要调用 Close
+func NewSYNScanner() (*SYNScanner, error) {
+	conn, err := net.ListenIP("ip4:tcp", nil)
+	if err != nil {
+		if errors.Is(err, os.ErrPermission) {
+			return nil, fmt.Errorf("SYN 扫描需要 root 权限或 CAP_NET_RAW: %w", err)
+		}
+		return nil, fmt.Errorf("创建原始套接字错误: %w", err)
+	}
+
+	s := &SYNScanner{
+		conn:    conn,
+		pending: make(map[synKey]*synProbe),
+	}
+	s.counter.Store(rand.Uint32())
+	go s.receive()
+	return s, nil
+}
+
+// Close 关闭原始套接字
+func (s *SYNScanner) Close() error {
+	return s.conn.Close()
+}
+
+// supports 判断是否可以对地址执行 SYN 扫描，IPv6 地址使用 connect 扫描
+func (s *SYNScanner) supports(addr string) bool {
+	ip, err := netip.ParseAddr(addr)
+	return err == nil && ip.Unmap().Is4()
+}
+
+// scan 向 addr 的端口发送 SYN 包并等待响应
+// 端口开放时返回 nil，收到 RST 时返回 ECONNREFUSED，超时无响应时返回超时错误
+func (s *SYNScanner) scan(ctx context.Context, addr string, port int, timeout time.Duration) error {
+	dst, err := netip.ParseAddr(addr)
+	if err != nil {
+		return err
+	}
+	dst = dst.Unmap()
+
+	src, err := s.source(dst)
+	if err != nil {
+		return err
+	}
+
+	key := synKey{
+		addr:       dst,
+		port:       uint16(port),
+		sourcePort: uint16(synPortBase + s.counter.Add(1)%synPortRange),
+	}
+	probe := &synProbe{seq: rand.Uint32(), reply: make(chan byte, 1)}
+
+	// 先登记再发送，避免响应先于登记到达
+	s.mu.Lock()
+	s.pending[key] = probe
+	s.mu.Unlock()
+	defer func() {
+		s.mu.Lock()
+		delete(s.pending, key)
+		s.mu.Unlock()
+	}()
+
+	packet := synPacket(src, dst, key.sourcePort, key.port, probe.seq)
+	if _, err := s.conn.WriteToIP(packet, &net.IPAddr{IP: dst.AsSlice()}); err != nil {
+		return err
+	}
+
+	opErr := &net.OpError{Op: "syn", Net: "tcp", Addr: net.TCPAddrFromAddrPort(netip.AddrPortFrom(dst, key.port))}
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+
+	select {
+	case flags := <-probe.reply:
+		if err := synResult(flags); err != nil {
+			opErr.Err = err
+			return opErr
+		}
+		return nil
+	case <-timer.C:
+		opErr.Err = os.ErrDeadlineExceeded
+		return opErr
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// source 返回发送到 dst 时使用的本地地址，用于计算校验和
+func (s *SYNScanner) source(dst netip.Addr) (netip.Addr, error) {
+	if src, ok := s.sources.Load(dst); ok {
+		return src.(netip.Addr), nil
+	}
+
+	// UDP 连接只查询路由，不会发送数据
+	conn, err := net.DialUDP("udp4", nil, net.UDPAddrFromAddrPort(netip.AddrPortFrom(dst, 9)))
+	if err != nil {
+		return netip.Addr{}, err
+	}
+	defer func() {
+		_ = conn.Close()
+	}()
+
+	src := conn.LocalAddr().(*net.UDPAddr).AddrPort().Addr().Unmap()
+	s.sources.Store(dst, src)
+	return src, nil
+}
+
+// receive 读取原始套接字收到的 TCP 包，将 SYN/ACK 和 RST 响应交给对应的探测，套接字关闭后退出
+func (s *SYNScanner) receive() {
+	buff := make([]byte, 1500)
+	for {
+		// IPv4 原始套接字读取时已去掉 IP 头
+		n, from, err := s.conn.ReadFromIP(buff)
+		if err != nil {
+			if errors.Is(err, net.ErrClosed) {
+				return
+			}
+			continue
+		}
+		addr, ok := netip.AddrFromSlice(from.IP)
+		if !ok {
+			continue
+		}
+		key, ack, flags, ok := parseSYNReply(addr, buff[:n])
+		if !ok {
+			continue
+		}
+
+		s.mu.Lock()
+		probe := s.pending[key]
+		s.mu.Unlock()
+		if probe == nil || !probe.accepts(ack) {
+			continue
+		}
+
+		select {
+		case probe.reply <- flags:
+		default:
+		}
+	}
+}
+
+// parseSYNReply 解析从 from 收到的 TCP 段（不含 IP 头），返回对应探测的 key、确认号和标志
+// 段不完整或既不是 SYN/ACK 也不是 RST 时 ok 为 false
+func parseSYNReply(from netip.Addr, segment []byte) (key synKey, ack uint32, flags byte, ok bool) {
+	if len(segment) < 20 {
+		return synKey{}, 0, 0, false
+	}
+
+	flags = segment[13]
+	if flags&(tcpFlagSYN|tcpFlagACK) != tcpFlagSYN|tcpFlagACK && flags&tcpFlagRST == 0 {
+		return synKey{}, 0, 0, false
+	}
+
+	// 响应的源端口是探测的目标端口，目标端口是探测的本地端口
+	key = synKey{
+		addr:       from.Unmap(),
+		port:       binary.BigEndian.Uint16(segment[0:2]),
+		sourcePort: binary.BigEndian.Uint16(segment[2:4]),
+	}
+	return key, binary.BigEndian.Uint32(segment[8:12]), flags, true
+}
+
+// accepts 检查响应的确认号是否对应该探测的 SYN 包（序号加一）
+func (p *synProbe) accepts(ack uint32) bool {
+	return ack == p.seq+1
+}
+
+// synResult 根据响应的 TCP 标志判断探测结果：SYN/ACK 表示端口开放返回 nil，RST 表示端口关闭返回 ECONNREFUSED
+func synResult(flags byte) error {
+	if flags&tcpFlagRST != 0 {
+		return syscall.ECONNREFUSED
+	}
+	return nil
+}
+
+// synPacket 构造带 MSS 选项的 TCP SYN 包（不含 IP 头，由内核添加）
+func synPacket(src, dst netip.Addr, sourcePort, port uint16, seq uint32) []byte {
+	packet := make([]byte, 24)
+	binary.BigEndian.PutUint16(packet[0:2], sourcePort)
+	binary.BigEndian.PutUint16(packet[2:4], port)
+	binary.BigEndian.PutUint32(packet[4:8], seq)
+	packet[12] = 6 << 4 // 首部长度：6 个 32 位字
+	packet[13] = tcpFlagSYN
+	binary.BigEndian.PutUint16(packet[14:16], 1024) // 窗口大小
+	// MSS 选项：类型 2，长度 4，值 1460
+	packet[20], packet[21] = 2, 4
+	binary.BigEndian.PutUint16(packet[22:24], 1460)
+
+	binary.BigEndian.PutUint16(packet[16:18], tcpChecksum(src, dst, packet))
+	return packet
+}
+
+// tcpChecksum 计算包含 IPv4 伪首部的 TCP 校验和
+func tcpChecksum(src, dst netip.Addr, segment []byte) uint16 {
+	s4, d4 := src.As4(), dst.As4()
+	pseudo := make([]byte, 0, 12+len(segment))
+	pseudo = append(pseudo, s4[:]...)
+	pseudo = append(pseudo, d4[:]...)
+	pseudo = append(pseudo, 0, syscall.IPPROTO_TCP)
+	pseudo = binary.BigEndian.AppendUint16(pseudo, uint16(len(segment)))
+	pseudo = append(pseudo, segment...)
+
+	var sum uint32
+	for i := 0; i+1 < len(pseudo); i += 2 {
+		sum += uint32(binary.BigEndian.Uint16(pseudo[i:]))
+	}
+	if len(pseudo)%2 == 1 {
+		sum += uint32(pseudo[len(pseudo)-1]) << 8
+	}
+	for sum > 0xffff {
+		sum = sum>>16 + sum&0xffff
+	}
+	return ^uint16(sum)
+}
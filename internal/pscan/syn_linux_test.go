@@ -0,0 +1,117 @@
+//go:build linux
+
+package pscan
+
+import (
+	"encoding/binary"
+	"encoding/hex"
+	"net/netip"
+	"testing"
+)
+
+func TestSYNPacket(t *testing.T) {
+	src := netip.MustParseAddr("192.168.1.2")
+	dst := netip.MustParseAddr("192.168.1.1")
+
+	// 独立计算的参考包：源端口 40001，目标端口 80，序号 0x01020304，窗口 1024，MSS 1460，校验和 0x703b
+	want := "9c410050010203040000000060020400703b0000020405b4"
+	if got := hex.EncodeToString(synPacket(src, dst, 40001, 80, 0x01020304)); got != want {
+		t.Errorf("synPacket = %s，期望 %s", got, want)
+	}
+}
+
+func TestTCPChecksum(t *testing.T) {
+	tests := []struct {
+		name     string
+		src, dst string
+		segment  string
+		want     uint16
+	}{
+		{name: "SYN 包", src: "192.168.1.2", dst: "192.168.1.1", segment: "9c410050010203040000000060020400" + "0000" + "0000020405b4", want: 0x703b},
+		{name: "奇数长度", src: "10.0.0.1", dst: "10.0.0.2", segment: "010203", want: 0xe7f1},
+		{name: "包含正确校验和的包校验结果为 0", src: "192.168.1.2", dst: "192.168.1.1", segment: "9c410050010203040000000060020400703b0000020405b4", want: 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			segment, err := hex.DecodeString(tt.segment)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := tcpChecksum(netip.MustParseAddr(tt.src), netip.MustParseAddr(tt.dst), segment); got != tt.want {
+				t.Errorf("tcpChecksum = %#04x，期望 %#04x", got, tt.want)
+			}
+		})
+	}
+}
+
+// replySegment 构造目标端口 port 发往本地端口 sourcePort 的响应段
+func replySegment(port, sourcePort uint16, ack uint32, flags byte) []byte {
+	segment := make([]byte, 20)
+	binary.BigEndian.PutUint16(segment[0:2], port)
+	binary.BigEndian.PutUint16(segment[2:4], sourcePort)
+	binary.BigEndian.PutUint32(segment[8:12], ack)
+	segment[12] = 5 << 4
+	segment[13] = flags
+	return segment
+}
+
+func TestParseSYNReply(t *testing.T) {
+	from := netip.MustParseAddr("::ffff:192.0.2.1")
+	probe := &synProbe{seq: 1000}
+
+	tests := []struct {
+		name    string
+		segment []byte
+		ok      bool
+		state   uint8 // ok 时按响应判断的端口状态
+	}{
+		{name: "SYN/ACK 表示开放", segment: replySegment(80, 40001, 1001, tcpFlagSYN|tcpFlagACK), ok: true, state: TCP_PORT_OPEN},
+		{name: "RST/ACK 表示关闭", segment: replySegment(80, 40001, 1001, tcpFlagRST|tcpFlagACK), ok: true, state: TCP_PORT_CLOSED},
+		{name: "RST 表示关闭", segment: replySegment(80, 40001, 1001, tcpFlagRST), ok: true, state: TCP_PORT_CLOSED},
+		{name: "只有 SYN 不是响应", segment: replySegment(80, 40001, 1001, tcpFlagSYN)},
+		{name: "只有 ACK 不是响应", segment: replySegment(80, 40001, 1001, tcpFlagACK)},
+		{name: "不完整的段", segment: replySegment(80, 40001, 1001, tcpFlagSYN|tcpFlagACK)[:19]},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			key, ack, flags, ok := parseSYNReply(from, tt.segment)
+			if ok != tt.ok {
+				t.Fatalf("parseSYNReply ok = %v，期望 %v", ok, tt.ok)
+			}
+			if !ok {
+				return
+			}
+
+			want := synKey{addr: netip.MustParseAddr("192.0.2.1"), port: 80, sourcePort: 40001}
+			if key != want {
+				t.Errorf("key = %+v，期望 %+v", key, want)
+			}
+			if !probe.accepts(ack) {
+				t.Errorf("确认号 %d 应与序号 %d 的探测匹配", ack, probe.seq)
+			}
+			if got := tcpState(synResult(flags)); got != tt.state {
+				t.Errorf("标志 %#02x 的端口状态 = %d，期望 %d", flags, got, tt.state)
+			}
+		})
+	}
+}
+
+func TestSYNProbeAccepts(t *testing.T) {
+	tests := []struct {
+		seq, ack uint32
+		want     bool
+	}{
+		{seq: 1000, ack: 1001, want: true},
+		{seq: 1000, ack: 1000},
+		{seq: 1000, ack: 1002},
+		{seq: 0xffffffff, ack: 0, want: true}, // 序号回绕
+	}
+	for _, tt := range tests {
+		probe := &synProbe{seq: tt.seq}
+		if got := probe.accepts(tt.ack); got != tt.want {
+			t.Errorf("序号 %d 的探测 accepts(%d) = %v，期望 %v", tt.seq, tt.ack, got, tt.want)
+		}
+	}
+}
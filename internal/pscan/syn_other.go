@@ -0,0 +1,32 @@
+//go:build !linux
+
+package pscan
+
+import (
+	"context"
+	"errors"
+	"time"
+)
+
+// SYNScanner 使用原始套接字发送 SYN 包的半开放扫描器，只支持 Linux
+type SYNScanner struct{}
+
+// NewSYNScanner 当前平台不支持 SYN 扫描，总是返回错误
+func NewSYNScanner() (*SYNScanner, error) {
+	return nil, errors.New("SYN 扫描只支持 Linux")
+}
+
+// Close 关闭扫描器
+func (s *SYNScanner) Close() error {
+	return nil
+}
+
+// supports 当前平台不支持 SYN 扫描
+func (s *SYNScanner) supports(addr string) bool {
+	return false
+}
+
+// scan 当前平台不支持 SYN 扫描
+func (s *SYNScanner) scan(ctx context.Context, addr string, port int, timeout time.Duration) error {
+	return errors.New("SYN 扫描只支持 Linux")
+}
@@ -0,0 +1,47 @@
+package pscan
+
+import (
+	"context"
+	"github.com/ezra-sullivan/net-sniff/internal/resolve"
+	"iter"
+)
+
+// target 单个扫描目标（主机 + 解析后的地址 + 端口）
+type target struct {
+	host string
+	addr string
+	port int
+}
+
+// portTargets 按需生成解析后的主机与端口的组合，不会预先展开全部目标
+func portTargets(hosts iter.Seq[resolve.Host], ports []int) iter.Seq[target] {
+	return func(yield func(target) bool) {
+		for host := range hosts {
+			for _, addr := range host.Addrs {
+				for _, port := range ports {
+					if !yield(target{host: host.Name, addr: addr, port: port}) {
+						return
+					}
+				}
+			}
+		}
+	}
+}
+
+// endpointTargets 将显式指定的 host:port 序列转换为扫描目标，主机名通过解析器解析，解析失败的目标会被跳过
+func endpointTargets(ctx context.Context, resolver *resolve.Resolver, endpoints iter.Seq2[string, int]) iter.Seq[target] {
+	return func(yield func(target) bool) {
+		for host, port := range endpoints {
+			addrs, err := resolver.Lookup(ctx, host)
+			if err != nil {
+				continue
+			}
+
+			for _, addr := range addrs {
+				if !yield(target{host: host, addr: addr, port: port}) {
+					return
+				}
+			}
+		}
+	}
+}
@@ -1,53 +1,130 @@
 package pscan
 
 import (
+	"context"
+	"errors"
 	"fmt"
 	"github.com/ezra-sullivan/net-sniff/internal/global"
+	"github.com/ezra-sullivan/net-sniff/internal/initialize/logger"
+	"github.com/ezra-sullivan/net-sniff/internal/resolve"
+	"github.com/ezra-sullivan/net-sniff/internal/retry"
+	"github.com/ezra-sullivan/net-sniff/internal/workpool"
+	"iter"
 	"net"
-	"sync"
+	"slices"
+	"strconv"
+	"syscall"
 	"time"
 )
 
+const (
+	TCP_PORT_CLOSED   uint8 = 0
+	TCP_PORT_OPEN     uint8 = 1
+	TCP_PORT_FILTERED uint8 = 2
+)
+
 // TCPScanResult 存储 TCP 端口扫描结果
 type TCPScanResult struct {
-	Success bool
-	Host    string
-	Port    int
-	IsOpen  bool
-	Error   error
-	Time    time.Duration
+	Success  bool
+	Host     string
+	Addr     string // 实际探测的地址，主机名经过解析后为其 IP 地址
+	Name     string // 启用反向解析时，开放端口所在 IP 地址对应的主机名
+	Port     int
+	IsOpen   bool
+	State    uint8     // 端口状态：TCP_PORT_OPEN、TCP_PORT_CLOSED 或 TCP_PORT_FILTERED
+	Banner   string    // 启用欢迎信息读取时，服务端发送的欢迎信息（已转换为单行可打印文本）
+	Service  string    // 启用服务识别时，开放端口的服务名，如 ssh、http
+	Product  string    // 启用服务识别时，识别出的产品名，如 OpenSSH、nginx
+	Version  string    // 启用服务识别时，识别出的版本号
+	TLS      *TLSInfo  // 启用 TLS 检查且端口支持 TLS 时，握手结果和证书摘要
+	HTTP     *HTTPInfo // 启用 HTTP 探测且端口响应 HTTP 请求时，最终响应的摘要
+	Attempts int       // 连接（或发送 SYN 包）的次数，包括重试
+	Error    error
+	Time     time.Duration
 }
 
 // ScanTCPPort 扫描单个 TCP 端口
 // ScanTCPPort 函数用于扫描指定的TCP端口是否开放
 func ScanTCPPort(host string, port int, timeout time.Duration) TCPScanResult {
+	return ScanTCPPortContext(context.Background(), host, port, timeout)
+}
 
-	// 将主机名和端口号拼接成地址
-	address := fmt.Sprintf("%s:%d", host, port)
-	// 记录开始时间
-	startTime := time.Now()
+// ScanTCPPortContext 扫描单个 TCP 端口，上下文取消时立即中止连接
+func ScanTCPPortContext(ctx context.Context, host string, port int, timeout time.Duration) TCPScanResult {
+	return scanTCPPort(ctx, nil, nil, nil, host, host, port, timeout, nil)
+}
+
+// ProbeTCPPort 扫描单个 TCP 端口，端口开放时执行 probes 中的附加探测（欢迎信息、服务识别、TLS 检查、HTTP 探测）
+func ProbeTCPPort(ctx context.Context, host string, port int, timeout time.Duration, probes *TCPProbes) TCPScanResult {
+	return scanTCPPort(ctx, nil, nil, nil, host, host, port, timeout, probes)
+}
 
-	// 尝试连接指定的TCP端口
-	conn, err := net.DialTimeout("tcp", address, timeout)
+// scanTCPPort 探测 addr 的 TCP 端口，结果中记录原始主机 host，端口开放时通过 resolver 反向解析 host
+// retries 不为 nil 时，超时无响应的连接按重试策略重试
+// syn 不为 nil 时对 IPv4 地址执行 SYN 扫描，否则建立完整连接；probes 不为 nil 时，端口开放后执行其中的附加探测
+func scanTCPPort(ctx context.Context, resolver *resolve.Resolver, retries *retry.Policy, syn *SYNScanner, host, addr string, port int, timeout time.Duration, probes *TCPProbes) TCPScanResult {
+
+	// 将主机名和端口号拼接成地址
+	address := net.JoinHostPort(addr, strconv.Itoa(port))
+	// 尝试连接指定的TCP端口，SYN 扫描只发送 SYN 包，不建立连接；超时无响应时按重试策略重试
+	dialer := net.Dialer{Timeout: timeout}
+	var conn net.Conn
+	var err error
+	var deration time.Duration
+	attempts := retries.Do(ctx, func(int) bool {
+		// 记录开始时间
+		startTime := time.Now()
+		if syn != nil && syn.supports(addr) {
+			err = syn.scan(ctx, addr, port, timeout)
+		} else {
+			conn, err = dialer.DialContext(ctx, "tcp", address)
+		}
+		// 在连接尝试后立即计算时间
+		deration = time.Since(startTime)
+		return isTimeout(err) && ctx.Err() == nil
+	})
 
-	// 在连接尝试后立即计算时间
-	deration := time.Since(startTime)
 	result := TCPScanResult{
-		Host:   host,
-		Port:   port,
-		Time:   deration,
-		Error:  err,
-		IsOpen: err == nil,
+		Host:     host,
+		Addr:     addr,
+		Port:     port,
+		Time:     deration,
+		Error:    err,
+		IsOpen:   err == nil,
+		State:    tcpState(err),
+		Attempts: attempts,
+	}
+
+	// 因上下文取消而中止的连接不输出结果
+	if err != nil && ctx.Err() != nil {
+		result.Error = ctx.Err()
+		return result
 	}
 
 	// 如果连接失败，则设置结果为未开放，并返回结果
-	if conn != nil {
-		defer func() {
-			err = conn.Close()
-			if err != nil {
-				result.Error = fmt.Errorf("注意内存溢出，关闭连接失败: %w", err)
-			}
-		}()
+	defer func() {
+		if conn == nil {
+			return
+		}
+		err = conn.Close()
+		if err != nil {
+			result.Error = fmt.Errorf("注意内存溢出，关闭连接失败: %w", err)
+		}
+	}()
+
+	// 端口开放时执行附加探测，SYN 扫描没有建立连接，需要先建立连接
+	if result.IsOpen && probes != nil {
+		if conn == nil {
+			conn, _ = dialer.DialContext(ctx, "tcp", address)
+		}
+		if conn != nil {
+			probes.run(ctx, conn, address, &result)
+		}
+	}
+
+	// 端口开放时反向解析主机名
+	if result.IsOpen {
+		result.Name = resolver.LookupName(ctx, host)
 	}
 
 	result.output()
@@ -57,39 +134,79 @@ func ScanTCPPort(host string, port int, timeout time.Duration) TCPScanResult {
 
 // BatchScanTCPPorts 批量扫描多个主机的多个 TCP 端口
 func BatchScanTCPPorts(hosts []string, ports []int, concurrency int, timeout time.Duration) []TCPScanResult {
+	results, _ := BatchScanTCPPortsContext(context.Background(), hosts, ports, concurrency, timeout)
+	return results
+}
+
+// BatchScanTCPPortsContext 批量扫描多个主机的多个 TCP 端口
+// 上下文取消后不再派发新任务并中止进行中的探测，返回已完成的结果和 ctx.Err()
+func BatchScanTCPPortsContext(ctx context.Context, hosts []string, ports []int, concurrency int, timeout time.Duration) ([]TCPScanResult, error) {
 	totalScans := len(hosts) * len(ports)
 	results := make([]TCPScanResult, 0, totalScans)
-	resultsChan := make(chan TCPScanResult, totalScans)
-
-	// 使用信号量控制并发
-	sem := make(chan struct{}, concurrency)
-	var wg sync.WaitGroup
-
-	for _, host := range hosts {
-		for _, port := range ports {
-			wg.Add(1)
-			go func(h string, p int) {
-				defer wg.Done()
-				sem <- struct{}{}        // 获取信号量
-				defer func() { <-sem }() // 释放信号量
-
-				resultsChan <- ScanTCPPort(h, p, timeout)
-			}(host, port)
-		}
-	}
-
-	// 等待所有 goroutine 完成
-	go func() {
-		wg.Wait()
-		close(resultsChan)
-	}()
 
 	// 收集结果
-	for result := range resultsChan {
+	for result := range StreamScanTCPPorts(ctx, resolve.Default(), slices.Values(hosts), ports, concurrency, timeout, nil, nil, nil) {
 		results = append(results, result)
 	}
 
-	return results
+	return results, ctx.Err()
+}
+
+// StreamScanTCPPorts 使用固定大小的工作池扫描惰性生成的主机序列的 TCP 端口，结果到达即发送到返回的通道
+// 每个主机名在探测前只解析一次；内存占用与目标数量无关；全部完成或上下文取消后通道关闭，调用方必须读完通道
+// retries 不为 nil 时超时无响应的连接按重试策略重试；syn 不为 nil 时对 IPv4 地址执行 SYN 扫描；probes 不为 nil 时对开放的端口执行附加探测；resolver 为 nil 时使用 resolve.Default()
+func StreamScanTCPPorts(ctx context.Context, resolver *resolve.Resolver, hosts iter.Seq[string], ports []int, concurrency int, timeout time.Duration, retries *retry.Policy, syn *SYNScanner, probes *TCPProbes) <-chan TCPScanResult {
+	if resolver == nil {
+		resolver = resolve.Default()
+	}
+	return streamTCP(ctx, resolver, portTargets(resolver.Stream(ctx, hosts, concurrency), ports), concurrency, timeout, retries, syn, probes)
+}
+
+// StreamScanTCPEndpoints 使用固定大小的工作池扫描显式指定的 host:port 序列，不会生成主机与端口的组合
+// 结果到达即发送到返回的通道；全部完成或上下文取消后通道关闭，调用方必须读完通道；resolver 为 nil 时使用 resolve.Default()
+func StreamScanTCPEndpoints(ctx context.Context, resolver *resolve.Resolver, endpoints iter.Seq2[string, int], concurrency int, timeout time.Duration, retries *retry.Policy, syn *SYNScanner, probes *TCPProbes) <-chan TCPScanResult {
+	if resolver == nil {
+		resolver = resolve.Default()
+	}
+	return streamTCP(ctx, resolver, endpointTargets(ctx, resolver, endpoints), concurrency, timeout, retries, syn, probes)
+}
+
+// streamTCP 使用固定大小的工作池扫描目标序列
+func streamTCP(ctx context.Context, resolver *resolve.Resolver, targets iter.Seq[target], concurrency int, timeout time.Duration, retries *retry.Policy, syn *SYNScanner, probes *TCPProbes) <-chan TCPScanResult {
+	return workpool.Run(ctx, targets, concurrency, func(ctx context.Context, t target) (TCPScanResult, bool) {
+		result := scanTCPPort(ctx, resolver, retries, syn, t.host, t.addr, t.port, timeout, probes)
+		// 因取消而中止的探测不计入结果
+		return result, ctx.Err() == nil || result.IsOpen
+	})
+}
+
+// tcpState 根据连接错误判断端口状态
+// 只有收到 RST（连接被拒绝或重置）时端口关闭；超时无响应、主机或网络不可达（防火墙丢弃或返回 ICMP 不可达）、
+// 本机防火墙或策略拒绝连接 (EACCES、EPERM) 以及其他无法确定目标是否响应的错误都视为端口被过滤
+func tcpState(err error) uint8 {
+	switch {
+	case err == nil:
+		return TCP_PORT_OPEN
+	case errors.Is(err, syscall.ECONNREFUSED), errors.Is(err, syscall.ECONNRESET):
+		return TCP_PORT_CLOSED
+	}
+	return TCP_PORT_FILTERED
+}
+
+// Status 返回端口状态的文本：open、closed 或 filtered
+func (result *TCPScanResult) Status() string {
+	switch result.State {
+	case TCP_PORT_OPEN:
+		return "open"
+	case TCP_PORT_FILTERED:
+		return "filtered"
+	}
+	return "closed"
+}
+
+// Address 返回 host:port 形式的地址，IPv6 地址带方括号（如 [::1]:80）
+func (result *TCPScanResult) Address() string {
+	return net.JoinHostPort(result.Host, strconv.Itoa(result.Port))
 }
 
 // 定义一个名为output的函数
@@ -99,17 +216,25 @@ func (result *TCPScanResult) output() {
 	if result.IsOpen {
 		// 打印TCP端口开放结果
 		consoleLogger.Info("TCP Port Scan Result",
-			"host", result.Host,
-			"port", result.Port,
+			"addr", result.Address(),
+			"ip", result.Addr,
+			resolve.NameAttr(result.Name),
 			"status", "open",
 			"time_ms", float64(result.Time.Microseconds())/1000.0,
+			retry.AttemptsAttr(result.Attempts),
+			serviceAttr(result.Service, result.Product, result.Version),
+			tlsAttr(result.TLS),
+			httpAttr(result.HTTP),
+			bannerAttr(result.Banner),
 		)
 	} else {
 		consoleLogger.Debug("TCP Port Scan Result",
-			"host", result.Host,
-			"port", result.Port,
-			"status", "closed",
+			"addr", result.Address(),
+			"ip", result.Addr,
+			resolve.NameAttr(result.Name),
+			"status", result.Status(),
 			"time_ms", float64(result.Time.Microseconds())/1000.0,
+			retry.AttemptsAttr(result.Attempts),
 			"err", result.Error,
 		)
 	}
@@ -120,11 +245,22 @@ func (result *TCPScanResult) output() {
 	if fileLogger != nil {
 		if result.IsOpen {
 			// 打印 TCP 端口开放结果到文件
-			fileLogger.Info(fmt.Sprintf("%s,%d,%s,%.2f\n", result.Host, result.Port, "open", float64(result.Time.Microseconds())/1000.0))
+			fileLogger.Info(result.csvLine())
 		} else {
-			// 打印TCP端口关闭结果到文件
-			fileLogger.Debug(fmt.Sprintf("%s,%d,%s,%.2f\n", result.Host, result.Port, "closed", float64(result.Time.Microseconds())/1000.0))
+			// 打印TCP端口关闭或被过滤的结果到文件，列与开放的端口相同，探测结果为空
+			fileLogger.Debug(result.csvLine())
 		}
 	}
 
 }
+
+// TCPColumns TCP 扫描结果文件的列名，新增的列只追加在末尾
+const TCPColumns = "host,port,status,time_ms,name,banner,service,product,version," +
+	"tls_version,tls_cipher,tls_subject,tls_issuer,tls_sans,tls_not_after,tls_expires_in_days," +
+	"http_status,http_title,http_server,http_content_length,http_final_url,ip"
+
+// csvLine 返回结果文件中的一行，列见 TCPColumns
+func (result *TCPScanResult) csvLine() string {
+	return fmt.Sprintf("%s,%d,%s,%.2f,%s,%s,%s,%s,%s,%s,%s,%s\n", result.Host, result.Port, result.Status(), float64(result.Time.Microseconds())/1000.0, result.Name,
+		logger.CSVField(result.Banner), result.Service, logger.CSVField(result.Product), logger.CSVField(result.Version), tlsFields(result.TLS), httpFields(result.HTTP), result.Addr)
+}
@@ -0,0 +1,84 @@
+package pscan
+
+import (
+	"context"
+	"errors"
+	"io"
+	"log/slog"
+	"net"
+	"os"
+	"slices"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/ezra-sullivan/net-sniff/internal/global"
+)
+
+// dialError 构造与 net.Dialer 返回的错误结构相同的连接错误
+func dialError(err error) error {
+	return &net.OpError{Op: "dial", Net: "tcp", Err: os.NewSyscallError("connect", err)}
+}
+
+// timeoutError 超时的网络错误
+type timeoutError struct{}
+
+func (timeoutError) Error() string   { return "i/o timeout" }
+func (timeoutError) Timeout() bool   { return true }
+func (timeoutError) Temporary() bool { return true }
+
+func TestTCPState(t *testing.T) {
+	tests := []struct {
+		name string
+		err  error
+		want uint8
+	}{
+		{name: "连接成功", err: nil, want: TCP_PORT_OPEN},
+		{name: "连接被拒绝", err: dialError(syscall.ECONNREFUSED), want: TCP_PORT_CLOSED},
+		{name: "连接被重置", err: dialError(syscall.ECONNRESET), want: TCP_PORT_CLOSED},
+		{name: "超时", err: &net.OpError{Op: "dial", Net: "tcp", Err: timeoutError{}}, want: TCP_PORT_FILTERED},
+		{name: "上下文超时", err: &net.OpError{Op: "dial", Net: "tcp", Err: context.DeadlineExceeded}, want: TCP_PORT_FILTERED},
+		{name: "主机不可达", err: dialError(syscall.EHOSTUNREACH), want: TCP_PORT_FILTERED},
+		{name: "网络不可达", err: dialError(syscall.ENETUNREACH), want: TCP_PORT_FILTERED},
+		{name: "本机策略拒绝 (EACCES)", err: dialError(syscall.EACCES), want: TCP_PORT_FILTERED},
+		{name: "本机策略拒绝 (EPERM)", err: dialError(syscall.EPERM), want: TCP_PORT_FILTERED},
+		{name: "地址不可用", err: dialError(syscall.EADDRNOTAVAIL), want: TCP_PORT_FILTERED},
+		{name: "未知错误", err: errors.New("unexpected"), want: TCP_PORT_FILTERED},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tcpState(tt.err); got != tt.want {
+				t.Errorf("tcpState(%v) = %d，期望 %d", tt.err, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestStreamScanTCPNilResolver(t *testing.T) {
+	global.ConsoleLogger = slog.New(slog.NewTextHandler(io.Discard, nil))
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		_ = listener.Close()
+	}()
+	port := listener.Addr().(*net.TCPAddr).Port
+
+	// resolver 为 nil 时使用默认解析器，主机名不会导致 panic
+	endpoints := func(yield func(string, int) bool) {
+		yield("localhost", port)
+	}
+	var results []TCPScanResult
+	for result := range StreamScanTCPEndpoints(context.Background(), nil, endpoints, 1, time.Second, nil, nil, nil) {
+		results = append(results, result)
+	}
+	for result := range StreamScanTCPPorts(context.Background(), nil, slices.Values([]string{"localhost"}), []int{port}, 1, time.Second, nil, nil, nil) {
+		results = append(results, result)
+	}
+	if len(results) != 2 {
+		t.Fatalf("得到 %d 个结果，期望 2 个", len(results))
+	}
+}
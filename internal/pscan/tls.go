@@ -0,0 +1,276 @@
+package pscan
+
+import (
+	"bufio"
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"github.com/ezra-sullivan/net-sniff/internal/global"
+	"github.com/ezra-sullivan/net-sniff/internal/initialize/logger"
+	"log/slog"
+	"net"
+	"net/netip"
+	"strings"
+	"time"
+)
+
+// TLSConfig TCP 端口开放后检查 TLS 证书和协议的配置
+type TLSConfig struct {
+	Timeout  time.Duration // 握手（包括 STARTTLS 协商）的超时时间
+	WarnDays int           // 证书剩余有效天数少于该值时输出警告
+}
+
+// TLSInfo TLS 握手结果和服务端证书摘要
+type TLSInfo struct {
+	StartTLS    string    // 使用的 STARTTLS 协议 (smtp、imap、pop3、ftp)，直接 TLS 时为空
+	Version     string    // 协商的 TLS 版本，如 TLS 1.3
+	CipherSuite string    // 协商的密码套件
+	Subject     string    // 证书主体
+	Issuer      string    // 证书颁发者
+	SANs        []string  // 证书的 DNS 名称和 IP 地址
+	NotBefore   time.Time // 证书生效时间
+	NotAfter    time.Time // 证书过期时间
+	VerifyError string    // 证书链或主机名校验失败的原因，校验通过时为空
+}
+
+// ExpiresIn 返回证书相对于 now 的剩余有效天数，已过期时为负数
+func (info *TLSInfo) ExpiresIn(now time.Time) int {
+	return int(info.NotAfter.Sub(now).Hours() / 24)
+}
+
+// startTLSPorts 默认使用 STARTTLS 的端口
+var startTLSPorts = map[int]string{
+	21:  "ftp",
+	25:  "smtp",
+	110: "pop3",
+	143: "imap",
+	587: "smtp",
+}
+
+// startTLSProtocol 根据识别出的服务名或端口选择 STARTTLS 协议，返回空字符串表示直接 TLS
+func startTLSProtocol(service string, port int) string {
+	switch service {
+	case "smtp", "imap", "pop3", "ftp":
+		return service
+	case "":
+		return startTLSPorts[port]
+	}
+	return ""
+}
+
+// inspectTLS 与服务端进行 TLS 握手并读取证书摘要，需要时先通过 STARTTLS 升级连接
+// conn 不为 nil 时复用该连接，否则建立新连接；host 为主机名时用作 SNI 和证书主机名校验
+// 端口不支持 TLS 或握手失败时返回 nil
+func inspectTLS(ctx context.Context, conn net.Conn, host, address string, port int, service string, config *TLSConfig) *TLSInfo {
+	if conn == nil {
+		dialer := net.Dialer{Timeout: config.Timeout}
+		var err error
+		if conn, err = dialer.DialContext(ctx, "tcp", address); err != nil {
+			return nil
+		}
+		defer func() {
+			_ = conn.Close()
+		}()
+	}
+
+	// 整个检查（包括 STARTTLS 协商）共用一个超时时间
+	if err := conn.SetDeadline(time.Now().Add(config.Timeout)); err != nil {
+		return nil
+	}
+	stop := context.AfterFunc(ctx, func() {
+		_ = conn.SetDeadline(time.Now())
+	})
+	defer stop()
+
+	protocol := startTLSProtocol(service, port)
+	if protocol != "" {
+		if err := startTLS(conn, protocol); err != nil {
+			return nil
+		}
+	}
+
+	// 只检查证书，不因证书无效而中止握手；允许旧版本协议以便记录
+	serverName := ""
+	if _, err := netip.ParseAddr(host); err != nil {
+		serverName = host
+	}
+	tlsConn := tls.Client(conn, &tls.Config{
+		ServerName:         serverName,
+		InsecureSkipVerify: true,
+		MinVersion:         tls.VersionTLS10,
+	})
+	if err := tlsConn.HandshakeContext(ctx); err != nil {
+		return nil
+	}
+
+	state := tlsConn.ConnectionState()
+	if len(state.PeerCertificates) == 0 {
+		return nil
+	}
+	cert := state.PeerCertificates[0]
+
+	info := &TLSInfo{
+		StartTLS:    protocol,
+		Version:     tls.VersionName(state.Version),
+		CipherSuite: tls.CipherSuiteName(state.CipherSuite),
+		Subject:     certName(cert.Subject.CommonName, cert.Subject.String()),
+		Issuer:      certName(cert.Issuer.CommonName, cert.Issuer.String()),
+		SANs:        cert.DNSNames,
+		NotBefore:   cert.NotBefore,
+		NotAfter:    cert.NotAfter,
+	}
+	for _, ip := range cert.IPAddresses {
+		info.SANs = append(info.SANs, ip.String())
+	}
+
+	// 使用系统根证书校验证书链和主机名
+	intermediates := x509.NewCertPool()
+	for _, c := range state.PeerCertificates[1:] {
+		intermediates.AddCert(c)
+	}
+	if _, err := cert.Verify(x509.VerifyOptions{DNSName: host, Intermediates: intermediates}); err != nil {
+		info.VerifyError = err.Error()
+	}
+
+	return info
+}
+
+// certName 优先使用 CN，没有 CN 时使用完整的 DN
+func certName(commonName, dn string) string {
+	if commonName != "" {
+		return commonName
+	}
+	return dn
+}
+
+// startTLS 按协议发送 STARTTLS 命令，服务端同意后连接可以开始 TLS 握手
+func startTLS(conn net.Conn, protocol string) error {
+	r := bufio.NewReader(conn)
+	switch protocol {
+	case "smtp":
+		if err := expectReply(r, "220"); err != nil {
+			return err
+		}
+		if err := sendCommand(conn, r, "EHLO net-sniff", "250"); err != nil {
+			return err
+		}
+		return sendCommand(conn, r, "STARTTLS", "220")
+	case "ftp":
+		if err := expectReply(r, "220"); err != nil {
+			return err
+		}
+		return sendCommand(conn, r, "AUTH TLS", "234")
+	case "pop3":
+		if err := expectReply(r, "+OK"); err != nil {
+			return err
+		}
+		return sendCommand(conn, r, "STLS", "+OK")
+	case "imap":
+		if err := expectReply(r, "* OK"); err != nil {
+			return err
+		}
+		if _, err := fmt.Fprint(conn, "a001 STARTTLS\r\n"); err != nil {
+			return err
+		}
+		// 跳过带 * 前缀的未标记响应
+		for {
+			line, err := r.ReadString('\n')
+			if err != nil {
+				return err
+			}
+			if strings.HasPrefix(line, "a001 ") {
+				return checkReply(line, "a001 OK")
+			}
+		}
+	}
+	return fmt.Errorf("不支持的 STARTTLS 协议: %s", protocol)
+}
+
+// sendCommand 发送一行命令并检查响应前缀
+func sendCommand(conn net.Conn, r *bufio.Reader, command, prefix string) error {
+	if _, err := fmt.Fprintf(conn, "%s\r\n", command); err != nil {
+		return err
+	}
+	return expectReply(r, prefix)
+}
+
+// expectReply 读取一个响应并检查前缀，SMTP/FTP 的多行响应 (如 "250-...") 会读到最后一行
+func expectReply(r *bufio.Reader, prefix string) error {
+	for {
+		line, err := r.ReadString('\n')
+		if err != nil {
+			return err
+		}
+		if len(line) >= 4 && line[3] == '-' {
+			continue
+		}
+		return checkReply(line, prefix)
+	}
+}
+
+// checkReply 检查响应行的前缀
+func checkReply(line, prefix string) error {
+	if !strings.HasPrefix(line, prefix) {
+		return fmt.Errorf("STARTTLS 失败: %s", strings.TrimSpace(line))
+	}
+	return nil
+}
+
+// tlsAttr 返回用于日志输出的 TLS 属性，未检查或不支持 TLS 时返回空属性（不会被输出）
+func tlsAttr(info *TLSInfo) slog.Attr {
+	if info == nil {
+		return slog.Attr{}
+	}
+
+	attrs := []any{
+		"version", info.Version,
+		"cipher", info.CipherSuite,
+		"subject", info.Subject,
+		"issuer", info.Issuer,
+		"sans", strings.Join(info.SANs, " "),
+		"not_after", info.NotAfter.Format(time.DateOnly),
+		"expires_in_days", info.ExpiresIn(time.Now()),
+	}
+	if info.StartTLS != "" {
+		attrs = append(attrs, "starttls", info.StartTLS)
+	}
+	if info.VerifyError != "" {
+		attrs = append(attrs, "verify_error", info.VerifyError)
+	}
+	return slog.Group("tls", attrs...)
+}
+
+// tlsFields 返回 CSV 中的 TLS 列：版本、密码套件、主体、颁发者、SAN、过期日期、剩余天数
+func tlsFields(info *TLSInfo) string {
+	if info == nil {
+		return ",,,,,,"
+	}
+	return fmt.Sprintf("%s,%s,%s,%s,%s,%s,%d", info.Version, info.CipherSuite, logger.CSVField(info.Subject), logger.CSVField(info.Issuer),
+		logger.CSVField(strings.Join(info.SANs, " ")), info.NotAfter.Format(time.DateOnly), info.ExpiresIn(time.Now()))
+}
+
+// warnExpiry 证书已过期或剩余有效天数少于 warnDays 时输出警告
+func (result *TCPScanResult) warnExpiry(warnDays int) {
+	if result.TLS == nil {
+		return
+	}
+
+	days := result.TLS.ExpiresIn(time.Now())
+	switch {
+	case days < 0:
+		global.ConsoleLogger.Warn("TLS 证书已过期",
+			"addr", result.Address(),
+			"subject", result.TLS.Subject,
+			"not_after", result.TLS.NotAfter.Format(time.DateOnly),
+			"expired_days", -days,
+		)
+	case days < warnDays:
+		global.ConsoleLogger.Warn(fmt.Sprintf("TLS 证书将在 %d 天后过期", days),
+			"addr", result.Address(),
+			"subject", result.TLS.Subject,
+			"not_after", result.TLS.NotAfter.Format(time.DateOnly),
+			"expires_in_days", days,
+		)
+	}
+}
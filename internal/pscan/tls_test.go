@@ -0,0 +1,242 @@
+package pscan
+
+import (
+	"bufio"
+	"context"
+	"crypto/tls"
+	"encoding/csv"
+	"io"
+	"log"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestStartTLSProtocol(t *testing.T) {
+	tests := []struct {
+		service string
+		port    int
+		want    string
+	}{
+		{service: "", port: 25, want: "smtp"},
+		{service: "", port: 587, want: "smtp"},
+		{service: "", port: 143, want: "imap"},
+		{service: "", port: 110, want: "pop3"},
+		{service: "", port: 21, want: "ftp"},
+		{service: "", port: 443, want: ""},
+		{service: "smtp", port: 2525, want: "smtp"},
+		{service: "imap", port: 10143, want: "imap"},
+		{service: "https", port: 25, want: ""}, // 识别出的服务优先于端口
+		{service: "ssh", port: 21, want: ""},
+	}
+	for _, tt := range tests {
+		if got := startTLSProtocol(tt.service, tt.port); got != tt.want {
+			t.Errorf("startTLSProtocol(%q, %d) = %q，期望 %q", tt.service, tt.port, got, tt.want)
+		}
+	}
+}
+
+// tlsServerConfig 返回测试服务器的 TLS 配置，证书包含 example.com 和 127.0.0.1
+func tlsServerConfig(t *testing.T) *tls.Config {
+	t.Helper()
+	server := httptest.NewTLSServer(http.NotFoundHandler())
+	t.Cleanup(server.Close)
+	return server.TLS.Clone()
+}
+
+// startTLSStep STARTTLS 协商中的一次交互：收到 expect 命令后回复 reply
+type startTLSStep struct {
+	expect string
+	reply  string
+}
+
+// startTLSServer 启动模拟的 STARTTLS 服务：发送 greeting，按顺序完成 steps 后开始 TLS 握手
+func startTLSServer(t *testing.T, config *tls.Config, greeting string, steps []startTLSStep) string {
+	t.Helper()
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		_ = listener.Close()
+	})
+
+	go func() {
+		conn, err := listener.Accept()
+		if err != nil {
+			return
+		}
+		defer func() {
+			_ = conn.Close()
+		}()
+
+		r := bufio.NewReader(conn)
+		_, _ = conn.Write([]byte(greeting))
+		for _, step := range steps {
+			line, err := r.ReadString('\n')
+			if err != nil || strings.TrimSpace(line) != step.expect {
+				return
+			}
+			_, _ = conn.Write([]byte(step.reply))
+		}
+		_ = tls.Server(conn, config).Handshake()
+	}()
+
+	return listener.Addr().String()
+}
+
+func TestInspectTLS(t *testing.T) {
+	config := tlsServerConfig(t)
+	server := httptest.NewUnstartedServer(http.NotFoundHandler())
+	server.TLS = config
+	server.Config.ErrorLog = log.New(io.Discard, "", 0)
+	server.StartTLS()
+	defer server.Close()
+
+	address := server.Listener.Addr().String()
+	info := inspectTLS(context.Background(), nil, "127.0.0.1", address, 443, "", &TLSConfig{Timeout: 2 * time.Second})
+	if info == nil {
+		t.Fatal("inspectTLS 返回 nil")
+	}
+
+	if info.StartTLS != "" || info.Version == "" || info.CipherSuite == "" {
+		t.Errorf("StartTLS = %q，Version = %q，CipherSuite = %q", info.StartTLS, info.Version, info.CipherSuite)
+	}
+	if !slices.Contains(info.SANs, "example.com") || !slices.Contains(info.SANs, "127.0.0.1") {
+		t.Errorf("SANs = %v，期望包含 example.com 和 127.0.0.1", info.SANs)
+	}
+	if info.Subject == "" || info.Issuer == "" || info.NotAfter.IsZero() {
+		t.Errorf("Subject = %q，Issuer = %q，NotAfter = %v", info.Subject, info.Issuer, info.NotAfter)
+	}
+	// 测试证书不是由系统根证书签发的
+	if info.VerifyError == "" {
+		t.Error("自签名证书应有校验错误")
+	}
+}
+
+func TestInspectTLSStartTLS(t *testing.T) {
+	config := tlsServerConfig(t)
+
+	tests := []struct {
+		name     string
+		service  string
+		greeting string
+		steps    []startTLSStep
+		ok       bool
+	}{
+		{
+			name: "smtp", service: "smtp", greeting: "220 mail ESMTP\r\n", ok: true,
+			steps: []startTLSStep{{expect: "EHLO net-sniff", reply: "250-mail\r\n250-SIZE 1024\r\n250 STARTTLS\r\n"}, {expect: "STARTTLS", reply: "220 go ahead\r\n"}},
+		},
+		{
+			name: "ftp", service: "ftp", greeting: "220 ftp ready\r\n", ok: true,
+			steps: []startTLSStep{{expect: "AUTH TLS", reply: "234 proceed\r\n"}},
+		},
+		{
+			name: "pop3", service: "pop3", greeting: "+OK pop3 ready\r\n", ok: true,
+			steps: []startTLSStep{{expect: "STLS", reply: "+OK begin\r\n"}},
+		},
+		{
+			name: "imap", service: "imap", greeting: "* OK imap ready\r\n", ok: true,
+			steps: []startTLSStep{{expect: "a001 STARTTLS", reply: "* CAPABILITY IMAP4rev1\r\na001 OK begin\r\n"}},
+		},
+		{
+			name: "smtp 拒绝 STARTTLS", service: "smtp", greeting: "220 mail ESMTP\r\n",
+			steps: []startTLSStep{{expect: "EHLO net-sniff", reply: "250 mail\r\n"}, {expect: "STARTTLS", reply: "454 TLS not available\r\n"}},
+		},
+		{
+			name: "imap 拒绝 STARTTLS", service: "imap", greeting: "* OK imap ready\r\n",
+			steps: []startTLSStep{{expect: "a001 STARTTLS", reply: "a001 BAD unknown\r\n"}},
+		},
+		{
+			name: "欢迎信息不符合协议", service: "pop3", greeting: "-ERR busy\r\n",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			address := startTLSServer(t, config, tt.greeting, tt.steps)
+			info := inspectTLS(context.Background(), nil, "127.0.0.1", address, 10000, tt.service, &TLSConfig{Timeout: 2 * time.Second})
+			if (info != nil) != tt.ok {
+				t.Fatalf("inspectTLS = %+v，期望成功 %v", info, tt.ok)
+			}
+			if info != nil && info.StartTLS != tt.service {
+				t.Errorf("StartTLS = %q，期望 %q", info.StartTLS, tt.service)
+			}
+		})
+	}
+}
+
+func TestInspectTLSPlaintext(t *testing.T) {
+	// 明文服务握手失败时返回 nil，上下文取消时不等待超时
+	server := httptest.NewServer(http.NotFoundHandler())
+	defer server.Close()
+
+	address := server.Listener.Addr().String()
+	if info := inspectTLS(context.Background(), nil, "127.0.0.1", address, 80, "", &TLSConfig{Timeout: 2 * time.Second}); info != nil {
+		t.Errorf("明文服务 inspectTLS = %+v，期望 nil", info)
+	}
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		_ = listener.Close()
+	}()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	time.AfterFunc(20*time.Millisecond, cancel)
+	start := time.Now()
+	if info := inspectTLS(ctx, nil, "127.0.0.1", listener.Addr().String(), 443, "", &TLSConfig{Timeout: 5 * time.Second}); info != nil {
+		t.Errorf("没有响应的服务 inspectTLS = %+v，期望 nil", info)
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("上下文取消后 inspectTLS 等待了 %v", elapsed)
+	}
+}
+
+func TestCertName(t *testing.T) {
+	if got := certName("example.com", "CN=example.com,O=Test"); got != "example.com" {
+		t.Errorf("certName = %q，期望 CN", got)
+	}
+	if got := certName("", "O=Acme Co"); got != "O=Acme Co" {
+		t.Errorf("certName = %q，期望完整 DN", got)
+	}
+}
+
+func TestTLSFields(t *testing.T) {
+	notAfter := time.Now().Add(72 * time.Hour)
+	info := &TLSInfo{
+		Version:     "TLS 1.3",
+		CipherSuite: "TLS_AES_128_GCM_SHA256",
+		Subject:     "O=Acme, Inc.",
+		Issuer:      "Test CA",
+		SANs:        []string{"example.com", "127.0.0.1"},
+		NotAfter:    notAfter,
+	}
+
+	tests := []struct {
+		name string
+		info *TLSInfo
+		want []string
+	}{
+		{name: "未检查 TLS", info: nil, want: []string{"", "", "", "", "", "", ""}},
+		{name: "字段包含逗号", info: info, want: []string{"TLS 1.3", "TLS_AES_128_GCM_SHA256", "O=Acme, Inc.", "Test CA", "example.com 127.0.0.1", notAfter.Format(time.DateOnly), "2"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := csv.NewReader(strings.NewReader(tlsFields(tt.info))).Read()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !slices.Equal(got, tt.want) {
+				t.Errorf("tlsFields = %q，期望 %q", got, tt.want)
+			}
+		})
+	}
+}
@@ -1,11 +1,20 @@
 package pscan
 
 import (
+	"context"
 	"errors"
 	"fmt"
 	"github.com/ezra-sullivan/net-sniff/internal/global"
+	"github.com/ezra-sullivan/net-sniff/internal/initialize/logger"
+	"github.com/ezra-sullivan/net-sniff/internal/resolve"
+	"github.com/ezra-sullivan/net-sniff/internal/retry"
+	"github.com/ezra-sullivan/net-sniff/internal/service"
+	"github.com/ezra-sullivan/net-sniff/internal/workpool"
+	"iter"
 	"net"
-	"sync"
+	"slices"
+	"strconv"
+	"syscall"
 	"time"
 )
 
@@ -13,28 +22,61 @@ const (
 	UDP_PORT_CLOSED           uint8 = 0
 	UDP_PORT_OPEN             uint8 = 1
 	UDP_PORT_OPEN_OR_FILTERED uint8 = 2
+	UDP_PORT_FILTERED         uint8 = 3
 )
 
 // UDPScanResult 存储 UDP 端口扫描结果
 type UDPScanResult struct {
-	Host   string
-	Port   int
-	IsOpen uint8
-	Error  error
-	Time   time.Duration
+	Host     string
+	Addr     string // 实际探测的地址，主机名经过解析后为其 IP 地址
+	Name     string // 启用反向解析时，开放端口所在 IP 地址对应的主机名
+	Port     int
+	IsOpen   uint8
+	Service  string // 启用服务识别时，识别出的服务名，如 domain、ntp
+	Product  string // 启用服务识别时，识别出的产品名，如 dnsmasq
+	Version  string // 启用服务识别时，识别出的版本号
+	Payload  string // 发送的载荷名称
+	Attempts int    // 发送载荷的次数，包括重试
+	Error    error
+	Time     time.Duration
 }
 
 // ScanUDPPort 扫描单个 UDP 端口
 func ScanUDPPort(host string, port int, timeout time.Duration) UDPScanResult {
+	return ScanUDPPortContext(context.Background(), host, port, timeout)
+}
+
+// ScanUDPPortContext 扫描单个 UDP 端口，上下文取消时立即中止等待响应
+func ScanUDPPortContext(ctx context.Context, host string, port int, timeout time.Duration) UDPScanResult {
+	return scanUDPPort(ctx, nil, nil, nil, host, host, port, timeout, nil, nil)
+}
+
+// ScanUDPPortRetry 扫描单个 UDP 端口，超时无响应时按 retries 重新发送载荷
+func ScanUDPPortRetry(ctx context.Context, host string, port int, timeout time.Duration, retries *retry.Policy) UDPScanResult {
+	return scanUDPPort(ctx, nil, retries, nil, host, host, port, timeout, nil, nil)
+}
+
+// DetectUDPService 扫描单个 UDP 端口，并按 services 配置识别服务和版本
+func DetectUDPService(ctx context.Context, host string, port int, timeout time.Duration, services *ServiceConfig) UDPScanResult {
+	return scanUDPPort(ctx, nil, nil, nil, host, host, port, timeout, nil, services)
+}
+
+// scanUDPPort 探测 addr 的 UDP 端口，结果中记录原始主机 host，端口开放时通过 resolver 反向解析 host
+// retries 不为 nil 时，超时无响应的探测按重试策略重新发送载荷
+// icmp 不为 nil 时根据收到的 ICMP 不可达消息判断端口关闭或被过滤，否则只根据套接字错误判断
+// payloads 为发送的载荷库，为 nil 时使用内置载荷库；services 不为 nil 时，对未关闭的端口执行服务识别，识别成功的端口视为开放
+func scanUDPPort(ctx context.Context, resolver *resolve.Resolver, retries *retry.Policy, icmp *ICMPListener, host, addr string, port int, timeout time.Duration, payloads *service.Payloads, services *ServiceConfig) UDPScanResult {
 
-	address := fmt.Sprintf("%s:%d", host, port)
+	address := net.JoinHostPort(addr, strconv.Itoa(port))
 	startTime := time.Now()
 
-	conn, err := net.DialTimeout("udp", address, timeout)
+	dialer := net.Dialer{Timeout: timeout}
+	conn, err := dialer.DialContext(ctx, "udp", address)
 
 	// 在连接尝试后立即计算时间
 	result := UDPScanResult{
 		Host:   host,
+		Addr:   addr,
 		Port:   port,
 		Error:  err,
 		IsOpen: UDP_PORT_CLOSED,
@@ -51,49 +93,90 @@ func ScanUDPPort(host string, port int, timeout time.Duration) UDPScanResult {
 		}
 	}()
 
-	// 发送一个的 UDP 包（DNS）
-	_, err = conn.Write([]byte{
-		0x12, 0x34, // ID
-		0x01, 0x00, // 标准查询
-		0x00, 0x01, // 1 个问题
-		0x00, 0x00, 0x00, 0x00, 0x00, 0x00, // 无答案等
-		0x03, 'w', 'w', 'w',
-		0x06, 'g', 'o', 'o', 'g', 'l', 'e',
-		0x03, 'c', 'o', 'm',
-		0x00,       // 终止
-		0x00, 0x01, // 类型 A
-		0x00, 0x01, // 类 IN
-	})
-	if err != nil {
-		result.Error = err
-		result.Time = time.Since(startTime)
-		return result
+	// 发送端口对应的载荷，如 DNS 查询、NTP 请求、SNMP GetRequest
+	if payloads == nil {
+		payloads = service.DefaultPayloads()
 	}
+	payload := payloads.Get(port)
+	result.Payload = payload.Name
 
-	// 设置读取超时
-	err = conn.SetReadDeadline(time.Now().Add(timeout))
-	if err != nil {
-		result.IsOpen = 0
-		result.Error = err
-		result.Time = time.Since(startTime)
-		return result
+	// 发送前登记，避免 ICMP 消息先于登记到达
+	var unreachable <-chan uint8
+	if icmp != nil {
+		var cancel func()
+		unreachable, cancel = icmp.watch(conn, addr, port)
+		defer cancel()
 	}
 
-	// 尝试读取响应
+	// 上下文取消时立即结束读取
+	stop := context.AfterFunc(ctx, func() {
+		_ = conn.SetReadDeadline(time.Now())
+	})
+	defer stop()
+
+	// 发送载荷并读取响应，超时无响应且没有收到 ICMP 不可达时按重试策略重新发送
+	var writeErr error
 	buff := make([]byte, 1024)
-	_, err = conn.Read(buff)
-	result.Time = time.Since(startTime)
+	result.Attempts = retries.Do(ctx, func(int) bool {
+		if _, writeErr = conn.Write(payload.Data); writeErr != nil {
+			return false
+		}
 
-	if err != nil {
-		var netErr net.Error
-		if errors.As(err, &netErr) && netErr.Timeout() {
-			// 超时无响应：开放或过滤
-			result.IsOpen = UDP_PORT_OPEN_OR_FILTERED
-			result.Error = nil
+		// 设置读取超时
+		if writeErr = conn.SetReadDeadline(time.Now().Add(timeout)); writeErr != nil {
+			return false
 		}
-	} else {
+		// 设置超时前上下文已取消时，AfterFunc 设置的截止时间已被覆盖
+		if err = ctx.Err(); err != nil {
+			return false
+		}
+
+		// 尝试读取响应
+		_, err = conn.Read(buff)
+		return isTimeout(err) && len(unreachable) == 0 && ctx.Err() == nil
+	})
+	result.Time = time.Since(startTime)
+
+	if writeErr != nil {
+		result.Error = writeErr
+		return result
+	}
+
+	// 因上下文取消而中止的探测不输出结果
+	if err != nil && ctx.Err() != nil {
+		result.Error = ctx.Err()
+		return result
+	}
+
+	if err == nil {
 		// 收到数据包：开放
 		result.IsOpen = UDP_PORT_OPEN
+	} else {
+		select {
+		case state := <-unreachable:
+			// 收到 ICMP 不可达：端口不可达时关闭，其他不可达时被过滤
+			result.IsOpen = state
+			result.Error = errors.New("收到 ICMP 目标不可达")
+		default:
+			result.IsOpen = udpState(err)
+			result.Error = err
+			if result.IsOpen == UDP_PORT_OPEN_OR_FILTERED {
+				result.Error = nil
+			}
+		}
+	}
+
+	// 识别服务和版本，收到可识别的响应说明端口开放
+	if result.IsOpen != UDP_PORT_CLOSED && services != nil {
+		if info, ok := detectUDP(ctx, address, port, services); ok {
+			result.Service, result.Product, result.Version = info.Service, info.Product, info.Version
+			result.IsOpen = UDP_PORT_OPEN
+		}
+	}
+
+	// 端口开放时反向解析主机名
+	if result.IsOpen == UDP_PORT_OPEN {
+		result.Name = resolver.LookupName(ctx, host)
 	}
 
 	result.output()
@@ -103,39 +186,70 @@ func ScanUDPPort(host string, port int, timeout time.Duration) UDPScanResult {
 
 // BatchScanUDPPorts 批量扫描多个主机的多个 UDP 端口
 func BatchScanUDPPorts(hosts []string, ports []int, concurrency int, timeout time.Duration) []UDPScanResult {
+	results, _ := BatchScanUDPPortsContext(context.Background(), hosts, ports, concurrency, timeout)
+	return results
+}
+
+// BatchScanUDPPortsContext 批量扫描多个主机的多个 UDP 端口
+// 上下文取消后不再派发新任务并中止进行中的探测，返回已完成的结果和 ctx.Err()
+func BatchScanUDPPortsContext(ctx context.Context, hosts []string, ports []int, concurrency int, timeout time.Duration) ([]UDPScanResult, error) {
 	totalScans := len(hosts) * len(ports)
 	results := make([]UDPScanResult, 0, totalScans)
-	resultsChan := make(chan UDPScanResult, totalScans)
-
-	// 使用信号量控制并发
-	sem := make(chan struct{}, concurrency)
-	var wg sync.WaitGroup
-
-	for _, host := range hosts {
-		for _, port := range ports {
-			wg.Add(1)
-			go func(h string, p int) {
-				defer wg.Done()
-				sem <- struct{}{}        // 获取信号量
-				defer func() { <-sem }() // 释放信号量
-
-				resultsChan <- ScanUDPPort(h, p, timeout)
-			}(host, port)
-		}
-	}
-
-	// 等待所有 goroutine 完成
-	go func() {
-		wg.Wait()
-		close(resultsChan)
-	}()
 
 	// 收集结果
-	for result := range resultsChan {
+	for result := range StreamScanUDPPorts(ctx, resolve.Default(), slices.Values(hosts), ports, concurrency, timeout, nil, nil, nil, nil) {
 		results = append(results, result)
 	}
 
-	return results
+	return results, ctx.Err()
+}
+
+// StreamScanUDPPorts 使用固定大小的工作池扫描惰性生成的主机序列的 UDP 端口，结果到达即发送到返回的通道
+// 每个主机名在探测前只解析一次；内存占用与目标数量无关；全部完成或上下文取消后通道关闭，调用方必须读完通道
+// retries 不为 nil 时超时无响应的探测按重试策略重新发送；icmp 不为 nil 时根据 ICMP 不可达消息判断端口状态；payloads 为 nil 时使用内置载荷库；services 不为 nil 时识别未关闭端口的服务和版本；resolver 为 nil 时使用 resolve.Default()
+func StreamScanUDPPorts(ctx context.Context, resolver *resolve.Resolver, hosts iter.Seq[string], ports []int, concurrency int, timeout time.Duration, retries *retry.Policy, icmp *ICMPListener, payloads *service.Payloads, services *ServiceConfig) <-chan UDPScanResult {
+	if resolver == nil {
+		resolver = resolve.Default()
+	}
+	return streamUDP(ctx, resolver, portTargets(resolver.Stream(ctx, hosts, concurrency), ports), concurrency, timeout, retries, icmp, payloads, services)
+}
+
+// StreamScanUDPEndpoints 使用固定大小的工作池扫描显式指定的 host:port 序列，不会生成主机与端口的组合
+// 结果到达即发送到返回的通道；全部完成或上下文取消后通道关闭，调用方必须读完通道；resolver 为 nil 时使用 resolve.Default()
+func StreamScanUDPEndpoints(ctx context.Context, resolver *resolve.Resolver, endpoints iter.Seq2[string, int], concurrency int, timeout time.Duration, retries *retry.Policy, icmp *ICMPListener, payloads *service.Payloads, services *ServiceConfig) <-chan UDPScanResult {
+	if resolver == nil {
+		resolver = resolve.Default()
+	}
+	return streamUDP(ctx, resolver, endpointTargets(ctx, resolver, endpoints), concurrency, timeout, retries, icmp, payloads, services)
+}
+
+// streamUDP 使用固定大小的工作池扫描目标序列
+func streamUDP(ctx context.Context, resolver *resolve.Resolver, targets iter.Seq[target], concurrency int, timeout time.Duration, retries *retry.Policy, icmp *ICMPListener, payloads *service.Payloads, services *ServiceConfig) <-chan UDPScanResult {
+	return workpool.Run(ctx, targets, concurrency, func(ctx context.Context, t target) (UDPScanResult, bool) {
+		result := scanUDPPort(ctx, resolver, retries, icmp, t.host, t.addr, t.port, timeout, payloads, services)
+		// 因取消而中止的探测不计入结果
+		return result, ctx.Err() == nil || result.IsOpen == UDP_PORT_OPEN
+	})
+}
+
+// udpState 根据读取响应时的错误判断端口状态
+// 超时无响应时开放或被过滤；连接被拒绝（ICMP 端口不可达）时关闭；主机、网络或协议不可达时被过滤
+func udpState(err error) uint8 {
+	switch {
+	case isTimeout(err):
+		return UDP_PORT_OPEN_OR_FILTERED
+	case errors.Is(err, syscall.ECONNREFUSED):
+		return UDP_PORT_CLOSED
+	case errors.Is(err, syscall.EHOSTUNREACH), errors.Is(err, syscall.ENETUNREACH),
+		errors.Is(err, syscall.EHOSTDOWN), errors.Is(err, syscall.ENOPROTOOPT), errors.Is(err, syscall.EACCES):
+		return UDP_PORT_FILTERED
+	}
+	return UDP_PORT_CLOSED
+}
+
+// Address 返回 host:port 形式的地址，IPv6 地址带方括号（如 [::1]:80）
+func (result *UDPScanResult) Address() string {
+	return net.JoinHostPort(result.Host, strconv.Itoa(result.Port))
 }
 
 func (result *UDPScanResult) output() {
@@ -145,37 +259,59 @@ func (result *UDPScanResult) output() {
 	if result.IsOpen == UDP_PORT_OPEN {
 		consoleLogger.Info("UDP Port Scan Result ",
 
-			"host", result.Host,
-			"port", result.Port,
+			"addr", result.Address(),
+			"ip", result.Addr,
+			resolve.NameAttr(result.Name),
 			"status", "open",
+			serviceAttr(result.Service, result.Product, result.Version),
+			"payload", result.Payload,
+			retry.AttemptsAttr(result.Attempts),
 			"time", result.Time)
 	} else if result.IsOpen == UDP_PORT_CLOSED {
 		consoleLogger.Error("UDP Port Scan Result ",
-			"host", result.Host,
-			"port", result.Port,
+			"addr", result.Address(),
+			"ip", result.Addr,
+			resolve.NameAttr(result.Name),
 			"status", "closed",
 			"time", result.Time,
 			"err", result.Error)
+	} else if result.IsOpen == UDP_PORT_FILTERED {
+		consoleLogger.Error("UDP Port Scan Result ",
+			"addr", result.Address(),
+			"ip", result.Addr,
+			resolve.NameAttr(result.Name),
+			"status", "filtered",
+			"time", result.Time,
+			"err", result.Error)
 	} else {
 		consoleLogger.Error("UDP Port Scan Result ",
-			"host", result.Host,
-			"port", result.Port,
+			"addr", result.Address(),
+			"ip", result.Addr,
+			resolve.NameAttr(result.Name),
 			"status", "open|filtered",
+			"payload", result.Payload,
+			retry.AttemptsAttr(result.Attempts),
 		)
 	}
 
-	// 获取全局的 fileLogger
+	// 获取全局的 fileLogger，列见 UDPColumns
 	fileLogger := global.FileLogger
 	// 如果 fileLogger 不为空
 	if fileLogger != nil {
 		if result.IsOpen == UDP_PORT_OPEN {
 			// 打印 TCP 端口开放结果到文件
-			fileLogger.Info(fmt.Sprintf("%s,%d,%s,%.2f\n", result.Host, result.Port, "open", float64(result.Time.Microseconds())/1000.0))
+			fileLogger.Info(fmt.Sprintf("%s,%d,%s,%.2f,%s,%s,%s,%s,%s\n", result.Host, result.Port, "open", float64(result.Time.Microseconds())/1000.0, result.Name,
+				result.Service, logger.CSVField(result.Product), logger.CSVField(result.Version), result.Addr))
 		} else if result.IsOpen == UDP_PORT_CLOSED {
 			// 打印TCP端口关闭结果到文件
-			fileLogger.Debug(fmt.Sprintf("%s,%d,%s,%.2f\n", result.Host, result.Port, "closed", float64(result.Time.Microseconds())/1000.0))
+			fileLogger.Debug(fmt.Sprintf("%s,%d,%s,%.2f,%s,,,,%s\n", result.Host, result.Port, "closed", float64(result.Time.Microseconds())/1000.0, result.Name, result.Addr))
+		} else if result.IsOpen == UDP_PORT_FILTERED {
+			fileLogger.Debug(fmt.Sprintf("%s,%d,%s,%.2f,%s,,,,%s\n", result.Host, result.Port, "filtered", float64(result.Time.Microseconds())/1000.0, result.Name, result.Addr))
 		} else {
-			fileLogger.Debug(fmt.Sprintf("%s,%d,%s,%.2f\n", result.Host, result.Port, "open|filtered", float64(result.Time.Microseconds())/1000.0))
+			fileLogger.Debug(fmt.Sprintf("%s,%d,%s,%.2f,%s,,,,%s\n", result.Host, result.Port, "open|filtered", float64(result.Time.Microseconds())/1000.0, result.Name, result.Addr))
 		}
 	}
 }
+
+// UDPColumns UDP 扫描结果文件的列名，新增的列只追加在末尾
+const UDPColumns = "host,port,status,time_ms,name,service,product,version,ip"
@@ -0,0 +1,227 @@
+package report
+
+import (
+	"cmp"
+	"fmt"
+	"github.com/ezra-sullivan/net-sniff/internal/global"
+	"github.com/ezra-sullivan/net-sniff/internal/initialize/logger"
+	"github.com/ezra-sullivan/net-sniff/internal/ping"
+	"github.com/ezra-sullivan/net-sniff/internal/pscan"
+	"github.com/ezra-sullivan/net-sniff/internal/resolve"
+	"github.com/ezra-sullivan/net-sniff/internal/service"
+	"log/slog"
+	"net/netip"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// Host 单个主机地址的合并结果
+type Host struct {
+	Host        string // 原始主机名或 IP 地址
+	Addr        string // 实际探测的 IP 地址
+	Name        string // 启用反向解析时 IP 地址对应的主机名
+	Alive       bool   // 是否响应 ping，跳过主机发现时为 false
+	TTL         uint8
+	TCP         []int     // 开放的 TCP 端口
+	UDP         []int     // 开放的 UDP 端口
+	UDPFiltered []int     // 开放或被过滤的 UDP 端口
+	Services    []Service // 启用服务识别时，识别出的服务
+}
+
+// Service 单个端口识别出的服务
+type Service struct {
+	Protocol string // tcp 或 udp
+	Port     int
+	Info     service.Info
+}
+
+// String 返回 "端口/协议 服务 产品 版本" 形式的描述
+func (s Service) String() string {
+	return fmt.Sprintf("%d/%s %s", s.Port, s.Protocol, s.Info)
+}
+
+// Report 按主机地址合并 ping、TCP 和 UDP 扫描结果，只记录存活或有开放端口的主机
+// 可以被多个协程并发调用
+type Report struct {
+	mu    sync.Mutex
+	hosts map[hostKey]*Host
+}
+
+// hostKey 主机 + 实际探测地址，启用 --all-addrs 时同一主机名的每个地址单独统计
+type hostKey struct {
+	host string
+	addr string
+}
+
+// New 创建空的报告
+func New() *Report {
+	return &Report{hosts: make(map[hostKey]*Host)}
+}
+
+// AddPing 记录 ping 结果，只保留存活的主机
+func (r *Report) AddPing(result ping.Result) {
+	if !result.Success {
+		return
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	h := r.host(result.Host, result.Addr, result.Name)
+	h.Alive = true
+	h.TTL = result.TTL
+}
+
+// AddTCP 记录 TCP 扫描结果，只保留开放的端口
+func (r *Report) AddTCP(result pscan.TCPScanResult) {
+	if !result.IsOpen {
+		return
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	h := r.host(result.Host, result.Addr, result.Name)
+	h.TCP = append(h.TCP, result.Port)
+	h.addService("tcp", result.Port, result.Service, result.Product, result.Version)
+}
+
+// AddUDP 记录 UDP 扫描结果，只保留开放或可能开放的端口
+func (r *Report) AddUDP(result pscan.UDPScanResult) {
+	if result.IsOpen == pscan.UDP_PORT_CLOSED || result.IsOpen == pscan.UDP_PORT_FILTERED {
+		return
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	h := r.host(result.Host, result.Addr, result.Name)
+	if result.IsOpen == pscan.UDP_PORT_OPEN {
+		h.UDP = append(h.UDP, result.Port)
+		h.addService("udp", result.Port, result.Service, result.Product, result.Version)
+	} else {
+		h.UDPFiltered = append(h.UDPFiltered, result.Port)
+	}
+}
+
+// host 返回主机地址对应的记录，不存在时创建，调用方需持有锁
+func (r *Report) host(host, addr, name string) *Host {
+	key := hostKey{host: host, addr: addr}
+	h, ok := r.hosts[key]
+	if !ok {
+		h = &Host{Host: host, Addr: addr}
+		r.hosts[key] = h
+	}
+	if h.Name == "" {
+		h.Name = name
+	}
+	return h
+}
+
+// addService 记录识别出的服务，未识别时忽略
+func (h *Host) addService(protocol string, port int, name, product, version string) {
+	if name == "" {
+		return
+	}
+	h.Services = append(h.Services, Service{
+		Protocol: protocol,
+		Port:     port,
+		Info:     service.Info{Service: name, Product: product, Version: version},
+	})
+}
+
+// Hosts 返回按 IP 地址排序的主机列表，端口按从小到大排序
+func (r *Report) Hosts() []Host {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	hosts := make([]Host, 0, len(r.hosts))
+	for _, h := range r.hosts {
+		host := *h
+		host.TCP = slices.Sorted(slices.Values(h.TCP))
+		host.UDP = slices.Sorted(slices.Values(h.UDP))
+		host.UDPFiltered = slices.Sorted(slices.Values(h.UDPFiltered))
+		host.Services = slices.SortedFunc(slices.Values(h.Services), func(a, b Service) int {
+			return cmp.Or(cmp.Compare(a.Protocol, b.Protocol), cmp.Compare(a.Port, b.Port))
+		})
+		hosts = append(hosts, host)
+	}
+
+	slices.SortFunc(hosts, func(a, b Host) int {
+		addrA, _ := netip.ParseAddr(a.Addr)
+		addrB, _ := netip.ParseAddr(b.Addr)
+		if c := addrA.Compare(addrB); c != 0 {
+			return c
+		}
+		return cmp.Compare(a.Host, b.Host)
+	})
+	return hosts
+}
+
+// Output 输出每个主机的合并结果，discovery 表示是否执行了主机发现
+func (r *Report) Output(discovery bool) {
+	for _, h := range r.Hosts() {
+		h.output(discovery)
+	}
+}
+
+// Columns 合并报告结果文件的列名，新增的列只追加在末尾
+const Columns = "host,ip,status,ttl,tcp,udp,udp_filtered,name,services"
+
+// output 输出单个主机的合并结果
+func (h *Host) output(discovery bool) {
+	// 获取全局的 consoleLogger
+	consoleLogger := global.ConsoleLogger
+
+	status := "up"
+	if !discovery {
+		status = "unknown"
+	} else if !h.Alive {
+		status = "no-ping"
+	}
+
+	consoleLogger.Info("Scan Report",
+		"host", h.Host,
+		"ip", h.Addr,
+		resolve.NameAttr(h.Name),
+		"status", status,
+		"ttl", h.TTL,
+		"tcp", joinPorts(h.TCP),
+		"udp", joinPorts(h.UDP),
+		"udp_filtered", joinPorts(h.UDPFiltered),
+		servicesAttr(h.Services),
+	)
+
+	// 获取全局的 fileLogger
+	fileLogger := global.FileLogger
+	if fileLogger != nil {
+		// 同一列中的多个端口以空格分隔
+		fileLogger.Info(fmt.Sprintf("%s,%s,%s,%d,%s,%s,%s,%s,%s\n", h.Host, h.Addr, status, h.TTL,
+			joinPorts(h.TCP), joinPorts(h.UDP), joinPorts(h.UDPFiltered), h.Name, logger.CSVField(joinServices(h.Services))))
+	}
+}
+
+// servicesAttr 返回用于日志输出的服务属性，没有识别出服务时返回空属性（不会被输出）
+func servicesAttr(services []Service) slog.Attr {
+	if len(services) == 0 {
+		return slog.Attr{}
+	}
+	return slog.String("services", joinServices(services))
+}
+
+// joinServices 将服务列表转换为分号分隔的字符串
+func joinServices(services []Service) string {
+	parts := make([]string, len(services))
+	for i, s := range services {
+		parts[i] = s.String()
+	}
+	return strings.Join(parts, "; ")
+}
+
+// joinPorts 将端口列表转换为空格分隔的字符串
+func joinPorts(ports []int) string {
+	parts := make([]string, len(ports))
+	for i, port := range ports {
+		parts[i] = strconv.Itoa(port)
+	}
+	return strings.Join(parts, " ")
+}
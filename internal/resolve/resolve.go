@@ -0,0 +1,242 @@
+package resolve
+
+import (
+	"context"
+	"fmt"
+	"github.com/ezra-sullivan/net-sniff/internal/global"
+	"github.com/ezra-sullivan/net-sniff/internal/workpool"
+	"iter"
+	"log/slog"
+	"net"
+	"net/netip"
+	"strings"
+	"sync"
+)
+
+// Resolver 在探测前解析主机名，每个主机名只解析一次，结果（包括失败）会被缓存
+// IP 地址不经过解析，原样返回；启用反向解析时还会缓存 IP 地址对应的主机名
+type Resolver struct {
+	resolver     *net.Resolver
+	allAddrs     bool
+	resolveNames bool
+
+	mu    sync.Mutex
+	addrs map[string]*entry // 主机名 -> IP 地址
+	names map[string]*entry // IP 地址 -> 主机名 (PTR)
+}
+
+// entry 单个查询的结果，done 关闭后 values、err 和 canceled 可读
+type entry struct {
+	done     chan struct{}
+	values   []string
+	err      error
+	canceled bool // 查询因发起者的上下文取消而失败，结果未被缓存
+}
+
+// Host 解析后的主机
+type Host struct {
+	Name  string   // 原始主机名或 IP 地址
+	Addrs []string // 需要探测的 IP 地址
+}
+
+var (
+	defaultOnce     sync.Once
+	defaultResolver *Resolver
+)
+
+// Default 返回使用系统解析器、只取第一个地址的共享解析器
+func Default() *Resolver {
+	defaultOnce.Do(func() {
+		defaultResolver, _ = New("", false, false)
+	})
+	return defaultResolver
+}
+
+// New 创建解析器
+// server 为 DNS 服务器地址 (如 1.1.1.1、1.1.1.1:53 或 [2606:4700::1111]:53)，为空时使用系统解析器
+// allAddrs 为 true 时返回主机名解析得到的全部地址，否则只返回第一个地址
+// resolveNames 为 true 时 LookupName 会查询 PTR 记录
+func New(server string, allAddrs, resolveNames bool) (*Resolver, error) {
+	r := &Resolver{
+		resolver:     net.DefaultResolver,
+		allAddrs:     allAddrs,
+		resolveNames: resolveNames,
+		addrs:        make(map[string]*entry),
+		names:        make(map[string]*entry),
+	}
+
+	if server == "" {
+		return r, nil
+	}
+
+	// 未指定端口时使用 53 端口
+	if _, _, err := net.SplitHostPort(server); err != nil {
+		server = net.JoinHostPort(server, "53")
+	}
+	host, _, err := net.SplitHostPort(server)
+	if err != nil || host == "" {
+		return nil, fmt.Errorf("无效的 DNS 服务器地址: %s", server)
+	}
+
+	// 所有查询都发送到指定的 DNS 服务器
+	r.resolver = &net.Resolver{
+		PreferGo: true,
+		Dial: func(ctx context.Context, network, _ string) (net.Conn, error) {
+			var dialer net.Dialer
+			return dialer.DialContext(ctx, network, server)
+		},
+	}
+	return r, nil
+}
+
+// Lookup 解析主机名，返回需要探测的 IP 地址
+// 同一主机名的并发查询只会发起一次解析，首次解析失败时输出警告
+func (r *Resolver) Lookup(ctx context.Context, name string) ([]string, error) {
+	// IP 地址无需解析
+	if _, err := netip.ParseAddr(name); err == nil {
+		return []string{name}, nil
+	}
+
+	addrs, first, err := r.cached(ctx, r.addrs, name, r.lookup)
+	if err != nil && first {
+		global.ConsoleLogger.Warn("主机名解析失败", "host", name, "err", err)
+	}
+	return addrs, err
+}
+
+// LookupName 反向解析 IP 地址对应的主机名
+// 未启用反向解析、addr 不是 IP 地址、没有 PTR 记录或解析失败时返回空字符串
+// 可以在 nil 解析器上调用；同一地址的并发查询只会发起一次解析
+func (r *Resolver) LookupName(ctx context.Context, addr string) string {
+	if r == nil || !r.resolveNames {
+		return ""
+	}
+	if _, err := netip.ParseAddr(addr); err != nil {
+		return ""
+	}
+
+	names, first, err := r.cached(ctx, r.names, addr, r.lookupAddr)
+	if err != nil {
+		if first {
+			global.ConsoleLogger.Debug("反向解析失败", "ip", addr, "err", err)
+		}
+		return ""
+	}
+	return names[0]
+}
+
+// NameAttr 返回用于日志输出的主机名属性，主机名为空时返回空属性（不会被输出）
+func NameAttr(name string) slog.Attr {
+	if name == "" {
+		return slog.Attr{}
+	}
+	return slog.String("name", name)
+}
+
+// cached 查询缓存，未命中时调用 query 并缓存结果，first 表示本次调用是否实际发起了查询
+// 因上下文取消而失败的查询不缓存，等待该查询的其他协程会重新查询
+func (r *Resolver) cached(ctx context.Context, cache map[string]*entry, key string, query func(context.Context, string) ([]string, error)) (values []string, first bool, err error) {
+	for {
+		r.mu.Lock()
+		e, ok := cache[key]
+		if !ok {
+			e = &entry{done: make(chan struct{})}
+			cache[key] = e
+		}
+		r.mu.Unlock()
+
+		if !ok {
+			return r.query(ctx, cache, key, e, query)
+		}
+
+		// 等待其他协程的查询结果
+		select {
+		case <-e.done:
+			if e.canceled {
+				continue
+			}
+			return e.values, false, e.err
+		case <-ctx.Done():
+			return nil, false, ctx.Err()
+		}
+	}
+}
+
+// query 调用 query 查询并填充缓存条目 e，上下文取消导致的失败会先从缓存中删除条目，再通知等待的协程重新查询
+func (r *Resolver) query(ctx context.Context, cache map[string]*entry, key string, e *entry, query func(context.Context, string) ([]string, error)) ([]string, bool, error) {
+	e.values, e.err = query(ctx, key)
+
+	if e.err != nil && ctx.Err() != nil {
+		e.canceled = true
+		r.mu.Lock()
+		delete(cache, key)
+		r.mu.Unlock()
+		close(e.done)
+		return nil, false, e.err
+	}
+
+	close(e.done)
+	return e.values, true, e.err
+}
+
+// lookup 向 DNS 查询主机名的 A 和 AAAA 记录
+func (r *Resolver) lookup(ctx context.Context, name string) ([]string, error) {
+	ips, err := r.resolver.LookupNetIP(ctx, "ip", name)
+	if err != nil {
+		return nil, err
+	}
+	if len(ips) == 0 {
+		return nil, fmt.Errorf("未找到主机 %s 的地址", name)
+	}
+
+	if !r.allAddrs {
+		ips = ips[:1]
+	}
+
+	addrs := make([]string, 0, len(ips))
+	for _, ip := range ips {
+		addrs = append(addrs, ip.Unmap().String())
+	}
+	return addrs, nil
+}
+
+// lookupAddr 查询 IP 地址的 PTR 记录，返回去掉末尾点号的主机名
+func (r *Resolver) lookupAddr(ctx context.Context, addr string) ([]string, error) {
+	names, err := r.resolver.LookupAddr(ctx, addr)
+	if err != nil {
+		return nil, err
+	}
+	if len(names) == 0 {
+		return nil, fmt.Errorf("未找到地址 %s 的主机名", addr)
+	}
+
+	for i, name := range names {
+		names[i] = strings.TrimSuffix(name, ".")
+	}
+	return names, nil
+}
+
+// Stream 使用固定大小的工作池解析惰性生成的主机序列，解析失败的主机会被跳过
+// 结果的顺序与输入不一定相同；上下文取消后停止解析
+func (r *Resolver) Stream(ctx context.Context, hosts iter.Seq[string], concurrency int) iter.Seq[Host] {
+	return func(yield func(Host) bool) {
+		resolved := workpool.Run(ctx, hosts, concurrency, func(ctx context.Context, name string) (Host, bool) {
+			addrs, err := r.Lookup(ctx, name)
+			return Host{Name: name, Addrs: addrs}, err == nil
+		})
+
+		// 提前结束时在后台读完通道，避免解析协程阻塞
+		defer func() {
+			go func() {
+				for range resolved {
+				}
+			}()
+		}()
+
+		for host := range resolved {
+			if !yield(host) {
+				return
+			}
+		}
+	}
+}
@@ -0,0 +1,332 @@
+package resolve
+
+import (
+	"context"
+	"io"
+	"log/slog"
+	"net"
+	"net/netip"
+	"slices"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/ezra-sullivan/net-sniff/internal/global"
+	"golang.org/x/net/dns/dnsmessage"
+)
+
+// dnsServer 只监听本地 UDP 端口的 DNS 服务器，按 records 应答并统计每个问题的查询次数
+type dnsServer struct {
+	addr    string
+	delay   time.Duration // 每个应答的延迟
+	records map[dnsmessage.Question][]dnsmessage.Resource
+
+	mu      sync.Mutex
+	queries map[dnsmessage.Question]int
+}
+
+// newDNSServer 启动 DNS 服务器，每个应答延迟 delay 后发送，测试结束时关闭
+func newDNSServer(t *testing.T, delay time.Duration, records []dnsmessage.Resource) *dnsServer {
+	t.Helper()
+
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("监听 UDP 端口错误: %v", err)
+	}
+	t.Cleanup(func() {
+		_ = conn.Close()
+	})
+
+	s := &dnsServer{
+		addr:    conn.LocalAddr().String(),
+		delay:   delay,
+		records: make(map[dnsmessage.Question][]dnsmessage.Resource),
+		queries: make(map[dnsmessage.Question]int),
+	}
+	for _, r := range records {
+		q := dnsmessage.Question{Name: r.Header.Name, Type: r.Header.Type, Class: dnsmessage.ClassINET}
+		s.records[q] = append(s.records[q], r)
+	}
+
+	go s.serve(conn)
+	return s
+}
+
+// serve 应答查询，没有记录的名称返回 NXDOMAIN
+func (s *dnsServer) serve(conn net.PacketConn) {
+	buf := make([]byte, 512)
+	for {
+		n, addr, err := conn.ReadFrom(buf)
+		if err != nil {
+			return
+		}
+
+		var msg dnsmessage.Message
+		if err := msg.Unpack(buf[:n]); err != nil || len(msg.Questions) != 1 {
+			continue
+		}
+		q := msg.Questions[0]
+
+		s.mu.Lock()
+		s.queries[q]++
+		s.mu.Unlock()
+
+		msg.Header.Response = true
+		msg.Header.Authoritative = true
+		msg.Header.RecursionAvailable = true
+		msg.Answers = s.records[q]
+		if !s.hasName(q.Name) {
+			msg.Header.RCode = dnsmessage.RCodeNameError
+		}
+
+		resp, err := msg.Pack()
+		if err != nil {
+			continue
+		}
+		go func() {
+			time.Sleep(s.delay)
+			_, _ = conn.WriteTo(resp, addr)
+		}()
+	}
+}
+
+// hasName 检查是否有该名称的任意记录
+func (s *dnsServer) hasName(name dnsmessage.Name) bool {
+	for q := range s.records {
+		if q.Name == name {
+			return true
+		}
+	}
+	return false
+}
+
+// count 返回指定名称和类型被查询的次数
+func (s *dnsServer) count(name string, typ dnsmessage.Type) int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.queries[dnsmessage.Question{Name: dnsmessage.MustNewName(name), Type: typ, Class: dnsmessage.ClassINET}]
+}
+
+// aRecord 构造 A 或 AAAA 记录
+func aRecord(name, addr string) dnsmessage.Resource {
+	ip := netip.MustParseAddr(addr)
+	header := dnsmessage.ResourceHeader{Name: dnsmessage.MustNewName(name), Class: dnsmessage.ClassINET, TTL: 60}
+	if ip.Is4() {
+		header.Type = dnsmessage.TypeA
+		return dnsmessage.Resource{Header: header, Body: &dnsmessage.AResource{A: ip.As4()}}
+	}
+	header.Type = dnsmessage.TypeAAAA
+	return dnsmessage.Resource{Header: header, Body: &dnsmessage.AAAAResource{AAAA: ip.As16()}}
+}
+
+// ptrRecord 构造 PTR 记录
+func ptrRecord(name, target string) dnsmessage.Resource {
+	header := dnsmessage.ResourceHeader{Name: dnsmessage.MustNewName(name), Type: dnsmessage.TypePTR, Class: dnsmessage.ClassINET, TTL: 60}
+	return dnsmessage.Resource{Header: header, Body: &dnsmessage.PTRResource{PTR: dnsmessage.MustNewName(target)}}
+}
+
+func testContext(t *testing.T) context.Context {
+	t.Helper()
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	t.Cleanup(cancel)
+	return ctx
+}
+
+func TestMain(m *testing.M) {
+	global.ConsoleLogger = slog.New(slog.NewTextHandler(io.Discard, nil))
+	m.Run()
+}
+
+func TestResolverLookup(t *testing.T) {
+	server := newDNSServer(t, 0, []dnsmessage.Resource{
+		aRecord("dual.example.", "192.0.2.1"),
+		aRecord("dual.example.", "192.0.2.2"),
+		aRecord("dual.example.", "2001:db8::1"),
+		aRecord("v4.example.", "192.0.2.10"),
+		aRecord("v6.example.", "2001:db8::10"),
+	})
+
+	tests := []struct {
+		name     string
+		host     string
+		allAddrs bool
+		want     []string // allAddrs 为 false 时结果应为其中之一
+		wantErr  bool
+	}{
+		{name: "IPv4 地址不解析", host: "198.51.100.1", want: []string{"198.51.100.1"}},
+		{name: "IPv6 地址不解析", host: "2001:db8::99", want: []string{"2001:db8::99"}},
+		{name: "全部地址", host: "dual.example.", allAddrs: true, want: []string{"192.0.2.1", "192.0.2.2", "2001:db8::1"}},
+		{name: "第一个地址", host: "dual.example.", want: []string{"192.0.2.1", "192.0.2.2", "2001:db8::1"}},
+		{name: "只有 A 记录", host: "v4.example.", allAddrs: true, want: []string{"192.0.2.10"}},
+		{name: "只有 AAAA 记录", host: "v6.example.", allAddrs: true, want: []string{"2001:db8::10"}},
+		{name: "不存在的主机", host: "missing.example.", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r, err := New(server.addr, tt.allAddrs, false)
+			if err != nil {
+				t.Fatalf("New(%q) 返回错误: %v", server.addr, err)
+			}
+
+			got, err := r.Lookup(testContext(t), tt.host)
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("Lookup(%q) 应返回错误，得到 %v", tt.host, got)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Lookup(%q) 返回错误: %v", tt.host, err)
+			}
+
+			if !tt.allAddrs {
+				if len(got) != 1 || !slices.Contains(tt.want, got[0]) {
+					t.Errorf("Lookup(%q) = %v，期望 %v 中的一个", tt.host, got, tt.want)
+				}
+				return
+			}
+			slices.Sort(got)
+			if !slices.Equal(got, tt.want) {
+				t.Errorf("Lookup(%q) = %v，期望 %v", tt.host, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestResolverLookupCache(t *testing.T) {
+	server := newDNSServer(t, 0, []dnsmessage.Resource{
+		aRecord("cached.example.", "192.0.2.1"),
+	})
+
+	r, err := New(server.addr, true, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx := testContext(t)
+
+	// 并发查询同一主机名只解析一次
+	var wg sync.WaitGroup
+	for range 10 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if addrs, err := r.Lookup(ctx, "cached.example."); err != nil || !slices.Equal(addrs, []string{"192.0.2.1"}) {
+				t.Errorf("Lookup = %v, %v", addrs, err)
+			}
+		}()
+	}
+	wg.Wait()
+	if n := server.count("cached.example.", dnsmessage.TypeA); n != 1 {
+		t.Errorf("cached.example. 的 A 记录被查询 %d 次，期望 1 次", n)
+	}
+
+	// 解析失败的结果同样被缓存
+	for range 2 {
+		if _, err := r.Lookup(ctx, "missing.example."); err == nil {
+			t.Fatal("Lookup(missing.example.) 应返回错误")
+		}
+	}
+	if n := server.count("missing.example.", dnsmessage.TypeA); n != 1 {
+		t.Errorf("missing.example. 的 A 记录被查询 %d 次，期望 1 次", n)
+	}
+
+	// 发起查询的协程被取消时，等待同一查询且上下文仍有效的协程重新查询，取消导致的失败不缓存
+	slow := newDNSServer(t, 200*time.Millisecond, []dnsmessage.Resource{
+		aRecord("slow.example.", "192.0.2.2"),
+	})
+	r, err = New(slow.addr, true, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	canceled, cancel := context.WithCancel(ctx)
+	firstErr := make(chan error, 1)
+	go func() {
+		_, err := r.Lookup(canceled, "slow.example.")
+		firstErr <- err
+	}()
+	for slow.count("slow.example.", dnsmessage.TypeA) == 0 {
+		time.Sleep(time.Millisecond)
+	}
+
+	waiter := make(chan error, 1)
+	go func() {
+		addrs, err := r.Lookup(ctx, "slow.example.")
+		if err == nil && !slices.Equal(addrs, []string{"192.0.2.2"}) {
+			t.Errorf("Lookup = %v", addrs)
+		}
+		waiter <- err
+	}()
+	time.Sleep(50 * time.Millisecond)
+	cancel()
+
+	if err := <-firstErr; err == nil {
+		t.Error("上下文取消后 Lookup 应返回错误")
+	}
+	if err := <-waiter; err != nil {
+		t.Errorf("等待被取消的查询的 Lookup 返回错误: %v", err)
+	}
+	if addrs, err := r.Lookup(ctx, "slow.example."); err != nil || !slices.Equal(addrs, []string{"192.0.2.2"}) {
+		t.Errorf("取消后再次 Lookup = %v, %v", addrs, err)
+	}
+}
+
+func TestResolverLookupName(t *testing.T) {
+	server := newDNSServer(t, 0, []dnsmessage.Resource{
+		ptrRecord("1.2.0.192.in-addr.arpa.", "host.example."),
+	})
+
+	r, err := New(server.addr, false, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx := testContext(t)
+
+	tests := []struct {
+		addr string
+		want string
+	}{
+		{addr: "192.0.2.1", want: "host.example"},
+		{addr: "192.0.2.2", want: ""},
+		{addr: "not-an-ip", want: ""},
+	}
+	for _, tt := range tests {
+		if got := r.LookupName(ctx, tt.addr); got != tt.want {
+			t.Errorf("LookupName(%q) = %q，期望 %q", tt.addr, got, tt.want)
+		}
+	}
+
+	// 未启用反向解析或解析器为 nil 时不查询
+	disabled, err := New(server.addr, false, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := disabled.LookupName(ctx, "192.0.2.1"); got != "" {
+		t.Errorf("未启用反向解析时 LookupName = %q", got)
+	}
+	var nilResolver *Resolver
+	if got := nilResolver.LookupName(ctx, "192.0.2.1"); got != "" {
+		t.Errorf("nil 解析器的 LookupName = %q", got)
+	}
+}
+
+func TestNew(t *testing.T) {
+	tests := []struct {
+		server  string
+		wantErr bool
+	}{
+		{server: ""},
+		{server: "192.0.2.53"},
+		{server: "192.0.2.53:5353"},
+		{server: "[2001:db8::53]:53"},
+		{server: "2001:db8::53"},
+		{server: ":53", wantErr: true},
+	}
+	for _, tt := range tests {
+		_, err := New(tt.server, false, false)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("New(%q) 错误 = %v，期望返回错误: %v", tt.server, err, tt.wantErr)
+		}
+	}
+}
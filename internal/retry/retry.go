@@ -0,0 +1,75 @@
+package retry
+
+import (
+	"context"
+	"log/slog"
+	"time"
+)
+
+const (
+	// maxBackoff 重试前等待的最长时间
+	maxBackoff = 10 * time.Second
+
+	// maxBackoffShift 计算退避时间时最多左移的位数，maxBackoff 左移该位数也不会溢出
+	maxBackoffShift = 20
+)
+
+// Policy 重试策略：探测失败后最多重试 Retries 次，第 n 次重试前等待 Backoff * 2^(n-1)（最长 10 秒）
+// 为 nil 时不重试
+type Policy struct {
+	Retries int
+	Backoff time.Duration
+}
+
+// NewPolicy 创建重试策略，retries 不大于 0 时返回 nil（不重试）
+func NewPolicy(retries int, backoff time.Duration) *Policy {
+	if retries <= 0 {
+		return nil
+	}
+	return &Policy{Retries: retries, Backoff: backoff}
+}
+
+// Do 执行 attempt 直到其返回 false（成功或不需要重试）、达到重试次数或上下文取消，返回执行的次数
+// attempt 的参数为当前是第几次执行，从 1 开始
+func (p *Policy) Do(ctx context.Context, attempt func(n int) bool) int {
+	n := 1
+	for attempt(n) {
+		if p == nil || n > p.Retries || !p.wait(ctx, n) {
+			break
+		}
+		n++
+	}
+	return n
+}
+
+// wait 等待第 n 次重试前的退避时间，上下文取消时返回 false
+func (p *Policy) wait(ctx context.Context, n int) bool {
+	delay := p.backoff(n)
+	if delay <= 0 {
+		return ctx.Err() == nil
+	}
+
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return true
+	case <-ctx.Done():
+		return false
+	}
+}
+
+// backoff 返回第 n 次重试前的退避时间 Backoff * 2^(n-1)，最长 maxBackoff
+// 移位前先限制 Backoff 和移位数，重试次数很大时也不会溢出
+func (p *Policy) backoff(n int) time.Duration {
+	shift := min(max(n-1, 0), maxBackoffShift)
+	return min(min(p.Backoff, maxBackoff)<<shift, maxBackoff)
+}
+
+// AttemptsAttr 返回用于日志输出的探测次数属性，只探测一次时返回空属性（不会被输出）
+func AttemptsAttr(attempts int) slog.Attr {
+	if attempts <= 1 {
+		return slog.Attr{}
+	}
+	return slog.Int("attempts", attempts)
+}
@@ -0,0 +1,105 @@
+package retry
+
+import (
+	"context"
+	"math"
+	"testing"
+	"time"
+)
+
+func TestNewPolicy(t *testing.T) {
+	if p := NewPolicy(0, time.Second); p != nil {
+		t.Errorf("NewPolicy(0) = %+v，期望 nil", p)
+	}
+	if p := NewPolicy(-1, time.Second); p != nil {
+		t.Errorf("NewPolicy(-1) = %+v，期望 nil", p)
+	}
+	if p := NewPolicy(3, time.Second); p == nil || p.Retries != 3 || p.Backoff != time.Second {
+		t.Errorf("NewPolicy(3, 1s) = %+v", p)
+	}
+}
+
+func TestPolicyBackoff(t *testing.T) {
+	tests := []struct {
+		name    string
+		backoff time.Duration
+		n       int
+		want    time.Duration
+	}{
+		{name: "第一次重试", backoff: 100 * time.Millisecond, n: 1, want: 100 * time.Millisecond},
+		{name: "指数增长", backoff: 100 * time.Millisecond, n: 4, want: 800 * time.Millisecond},
+		{name: "达到上限", backoff: 100 * time.Millisecond, n: 8, want: maxBackoff},
+		{name: "超过移位上限", backoff: 100 * time.Millisecond, n: 64, want: maxBackoff},
+		{name: "很大的重试次数", backoff: time.Second, n: math.MaxInt, want: maxBackoff},
+		{name: "很大的退避时间", backoff: math.MaxInt64, n: 40, want: maxBackoff},
+		{name: "退避时间为 0", backoff: 0, n: 30, want: 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := &Policy{Backoff: tt.backoff}
+			if got := p.backoff(tt.n); got != tt.want {
+				t.Errorf("backoff(%d) = %v，期望 %v", tt.n, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestPolicyDo(t *testing.T) {
+	tests := []struct {
+		name      string
+		policy    *Policy
+		failures  int // attempt 前几次返回 true（需要重试）
+		wantCalls int
+	}{
+		{name: "nil 策略只执行一次", policy: nil, failures: 5, wantCalls: 1},
+		{name: "第一次成功", policy: &Policy{Retries: 3}, failures: 0, wantCalls: 1},
+		{name: "重试后成功", policy: &Policy{Retries: 3}, failures: 2, wantCalls: 3},
+		{name: "达到重试次数", policy: &Policy{Retries: 3}, failures: 10, wantCalls: 4},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			calls := 0
+			got := tt.policy.Do(context.Background(), func(n int) bool {
+				calls++
+				if n != calls {
+					t.Errorf("第 %d 次执行的参数为 %d", calls, n)
+				}
+				return calls <= tt.failures
+			})
+			if calls != tt.wantCalls || got != tt.wantCalls {
+				t.Errorf("执行 %d 次，Do 返回 %d，期望 %d", calls, got, tt.wantCalls)
+			}
+		})
+	}
+}
+
+func TestPolicyDoCanceledWhileWaiting(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	p := &Policy{Retries: 3, Backoff: maxBackoff}
+
+	time.AfterFunc(20*time.Millisecond, cancel)
+	start := time.Now()
+	calls := 0
+	got := p.Do(ctx, func(int) bool {
+		calls++
+		return true
+	})
+
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("上下文取消后 Do 等待了 %v", elapsed)
+	}
+	if calls != 1 || got != 1 {
+		t.Errorf("执行 %d 次，Do 返回 %d，期望 1", calls, got)
+	}
+}
+
+func TestAttemptsAttr(t *testing.T) {
+	if attr := AttemptsAttr(1); attr.Key != "" {
+		t.Errorf("AttemptsAttr(1) = %v，期望空属性", attr)
+	}
+	if attr := AttemptsAttr(3); attr.Key != "attempts" || attr.Value.Int64() != 3 {
+		t.Errorf("AttemptsAttr(3) = %v", attr)
+	}
+}
@@ -0,0 +1,143 @@
+package service
+
+import (
+	"bufio"
+	_ "embed"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"sync"
+)
+
+//go:embed data/udp-payloads.txt
+var defaultPayloads string
+
+// Payload UDP 扫描时发送的载荷
+type Payload struct {
+	Name string
+	Data []byte
+
+	ports [][2]int // 使用该载荷的端口范围，为空时是通用载荷
+}
+
+// Payloads UDP 扫描载荷库，按端口选择载荷
+type Payloads struct {
+	payloads []*Payload
+}
+
+// DefaultPayloads 返回内置的 UDP 载荷库
+var DefaultPayloads = sync.OnceValue(func() *Payloads {
+	p := &Payloads{}
+	if err := p.load(strings.NewReader(defaultPayloads), "内置载荷库"); err != nil {
+		panic(err)
+	}
+	return p
+})
+
+// NewPayloads 创建包含内置载荷的载荷库，file 不为空时还会加载其中的载荷，文件中的载荷优先于内置载荷
+func NewPayloads(file string) (*Payloads, error) {
+	p := &Payloads{}
+
+	if file != "" {
+		f, err := os.Open(file)
+		if err != nil {
+			return nil, fmt.Errorf("读取载荷库文件错误: %w", err)
+		}
+		defer func() {
+			_ = f.Close()
+		}()
+
+		if err := p.load(f, file); err != nil {
+			return nil, err
+		}
+	}
+
+	p.payloads = append(p.payloads, DefaultPayloads().payloads...)
+	return p, nil
+}
+
+// FixedPayload 创建对所有端口发送同一载荷的载荷库
+func FixedPayload(data []byte) *Payloads {
+	return &Payloads{payloads: []*Payload{{Name: "custom", Data: data}}}
+}
+
+// Get 返回端口使用的载荷：最先出现的声明了该端口的载荷，没有时使用最先出现的通用载荷
+func (p *Payloads) Get(port int) *Payload {
+	var generic *Payload
+	for _, payload := range p.payloads {
+		if len(payload.ports) == 0 {
+			if generic == nil {
+				generic = payload
+			}
+			continue
+		}
+		if inPortRanges(payload.ports, port) {
+			return payload
+		}
+	}
+
+	if generic == nil {
+		return &Payload{Name: "generic"}
+	}
+	return generic
+}
+
+// load 解析载荷库，source 用于错误信息
+func (p *Payloads) load(r io.Reader, source string) error {
+	var payload *Payload
+	scanner := bufio.NewScanner(r)
+	for lineNo := 1; scanner.Scan(); lineNo++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		directive, rest, _ := strings.Cut(line, " ")
+		rest = strings.TrimSpace(rest)
+
+		var err error
+		switch directive {
+		case "Payload":
+			if payload, err = parsePayload(rest); err == nil {
+				p.payloads = append(p.payloads, payload)
+			}
+		case "ports":
+			if payload == nil {
+				err = fmt.Errorf("ports 必须位于 Payload 之后")
+				break
+			}
+			var ports [][2]int
+			if ports, err = parsePortRanges(rest); err == nil {
+				payload.ports = append(payload.ports, ports...)
+			}
+		default:
+			err = fmt.Errorf("未知的指令: %s", directive)
+		}
+
+		if err != nil {
+			return fmt.Errorf("%s 第 %d 行: %w", source, lineNo, err)
+		}
+	}
+
+	return scanner.Err()
+}
+
+// parsePayload 解析 "名称 q|载荷|"
+func parsePayload(s string) (*Payload, error) {
+	name, rest, _ := strings.Cut(s, " ")
+	rest = strings.TrimSpace(rest)
+	if name == "" || !strings.HasPrefix(rest, "q") {
+		return nil, fmt.Errorf("无效的 Payload: %s", s)
+	}
+
+	data, rest, err := cutDelimited(rest[1:])
+	if err != nil || strings.TrimSpace(rest) != "" {
+		return nil, fmt.Errorf("无效的载荷: %s", s)
+	}
+	payload, err := unescape(data)
+	if err != nil {
+		return nil, err
+	}
+	return &Payload{Name: name, Data: payload}, nil
+}
@@ -0,0 +1,107 @@
+package service
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestDefaultPayloads(t *testing.T) {
+	// DefaultPayloads 在内置载荷库无效时 panic，这里直接解析以便返回错误
+	p := &Payloads{}
+	if err := p.load(strings.NewReader(defaultPayloads), "内置载荷库"); err != nil {
+		t.Fatalf("解析内置载荷库错误: %v", err)
+	}
+
+	tests := []struct {
+		port int
+		want string
+	}{
+		{port: 53, want: "dns"},
+		{port: 123, want: "ntp"},
+		{port: 7, want: "echo"},
+		{port: 40000, want: "generic"},
+	}
+	for _, tt := range tests {
+		if got := DefaultPayloads().Get(tt.port).Name; got != tt.want {
+			t.Errorf("Get(%d) = %s，期望 %s", tt.port, got, tt.want)
+		}
+	}
+}
+
+func TestNewPayloadsFile(t *testing.T) {
+	// 文件中的载荷优先于内置载荷，未声明的端口仍使用内置载荷
+	file := filepath.Join(t.TempDir(), "payloads.txt")
+	content := "# 自定义载荷\nPayload my-dns q/\\x00\\x01|/\nports 53, 5353\n"
+	if err := os.WriteFile(file, []byte(content), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	p, err := NewPayloads(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		port int
+		want string
+		data string
+	}{
+		{port: 53, want: "my-dns", data: "\x00\x01|"},
+		{port: 5353, want: "my-dns", data: "\x00\x01|"},
+		{port: 123, want: "ntp"},
+	}
+	for _, tt := range tests {
+		payload := p.Get(tt.port)
+		if payload.Name != tt.want {
+			t.Errorf("Get(%d) = %s，期望 %s", tt.port, payload.Name, tt.want)
+		}
+		if tt.data != "" && string(payload.Data) != tt.data {
+			t.Errorf("Get(%d).Data = %q，期望 %q", tt.port, payload.Data, tt.data)
+		}
+	}
+
+	if _, err := NewPayloads(filepath.Join(t.TempDir(), "missing.txt")); err == nil {
+		t.Error("载荷库文件不存在时应返回错误")
+	}
+}
+
+func TestPayloadsLoadMalformed(t *testing.T) {
+	tests := []struct {
+		name  string
+		input string
+	}{
+		{name: "未知指令", input: "Probe TCP NULL q||"},
+		{name: "ports 在 Payload 之前", input: "ports 53"},
+		{name: "缺少名称和载荷", input: "Payload"},
+		{name: "载荷缺少 q", input: "Payload dns |\\x00|"},
+		{name: "载荷缺少结束分隔符", input: "Payload dns q|\\x00"},
+		{name: "载荷后有多余内容", input: "Payload dns q|\\x00| extra"},
+		{name: "无效的转义", input: "Payload dns q|\\xzz|"},
+		{name: "无效的端口", input: "Payload dns q||\nports 65536"},
+		{name: "端口不是数字", input: "Payload dns q||\nports dns"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := &Payloads{}
+			err := p.load(strings.NewReader(tt.input), "test")
+			if err == nil {
+				t.Fatalf("解析 %q 应返回错误", tt.input)
+			}
+			if !strings.HasPrefix(err.Error(), "test 第 ") {
+				t.Errorf("错误信息应包含来源和行号: %v", err)
+			}
+		})
+	}
+}
+
+func TestFixedPayload(t *testing.T) {
+	p := FixedPayload([]byte("ping"))
+	for _, port := range []int{53, 40000} {
+		if payload := p.Get(port); payload.Name != "custom" || string(payload.Data) != "ping" {
+			t.Errorf("Get(%d) = %+v", port, payload)
+		}
+	}
+}
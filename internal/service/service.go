@@ -0,0 +1,387 @@
+package service
+
+import (
+	"bufio"
+	_ "embed"
+	"fmt"
+	"io"
+	"os"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+//go:embed data/service-probes.txt
+var defaultProbes string
+
+// Info 服务识别结果
+type Info struct {
+	Service string // 服务名，如 ssh、http
+	Product string // 产品名，如 OpenSSH、nginx
+	Version string // 版本号，如 8.9p1
+}
+
+// String 返回 "服务 产品 版本" 形式的描述，省略为空的部分
+func (i Info) String() string {
+	return strings.Join(strings.Fields(i.Service+" "+i.Product+" "+i.Version), " ")
+}
+
+// Probe 单个探测：向服务端发送载荷，并用匹配规则识别响应
+type Probe struct {
+	Protocol string // tcp 或 udp
+	Name     string
+	Payload  []byte // 为空时只读取服务端主动发送的数据
+
+	ports   [][2]int // 优先使用该探测的端口范围
+	matches []*match
+}
+
+// match 单条匹配规则
+type match struct {
+	service string
+	pattern *regexp.Regexp
+	product string
+	version string
+}
+
+// Database 探测库
+type Database struct {
+	probes []*Probe
+}
+
+// New 创建包含内置探测的探测库，file 不为空时还会加载其中的探测
+// 文件中的探测和匹配规则优先于内置探测库；与内置探测同协议、同名称的探测会合并端口和匹配规则
+func New(file string) (*Database, error) {
+	db := &Database{}
+
+	if file != "" {
+		f, err := os.Open(file)
+		if err != nil {
+			return nil, fmt.Errorf("读取探测库文件错误: %w", err)
+		}
+		defer func() {
+			_ = f.Close()
+		}()
+
+		if err := db.load(f, file); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := db.load(strings.NewReader(defaultProbes), "内置探测库"); err != nil {
+		return nil, err
+	}
+	return db, nil
+}
+
+// Probes 返回适用于指定协议和端口的探测，按以下顺序排列：
+// 空载荷探测 (NULL)、声明了该端口的探测、其余 TCP 探测（UDP 探测只使用声明了该端口的探测）
+func (db *Database) Probes(protocol string, port int) []*Probe {
+	var null, hinted, others []*Probe
+	for _, probe := range db.probes {
+		if probe.Protocol != protocol {
+			continue
+		}
+		switch {
+		case len(probe.Payload) == 0:
+			null = append(null, probe)
+		case probe.hasPort(port):
+			hinted = append(hinted, probe)
+		case protocol == "tcp":
+			others = append(others, probe)
+		}
+	}
+	return slices.Concat(null, hinted, others)
+}
+
+// Match 使用探测的匹配规则识别响应，TCP 响应未匹配时继续尝试 NULL 探测的规则
+func (db *Database) Match(probe *Probe, response []byte) (Info, bool) {
+	if len(response) == 0 {
+		return Info{}, false
+	}
+
+	// 正则按字节匹配，每个字节转换为对应的 Unicode 码点
+	text := latin1(response)
+
+	if info, ok := probe.match(text); ok {
+		return info, true
+	}
+
+	if probe.Protocol == "tcp" && len(probe.Payload) > 0 {
+		for _, null := range db.probes {
+			if null.Protocol == "tcp" && len(null.Payload) == 0 {
+				if info, ok := null.match(text); ok {
+					return info, true
+				}
+			}
+		}
+	}
+	return Info{}, false
+}
+
+// match 依次尝试探测的匹配规则
+func (p *Probe) match(text string) (Info, bool) {
+	for _, m := range p.matches {
+		groups := m.pattern.FindStringSubmatchIndex(text)
+		if groups == nil {
+			continue
+		}
+		return Info{
+			Service: m.service,
+			Product: expand(m.pattern, m.product, text, groups),
+			Version: expand(m.pattern, m.version, text, groups),
+		}, true
+	}
+	return Info{}, false
+}
+
+// hasPort 判断探测是否适用于端口
+func (p *Probe) hasPort(port int) bool {
+	return inPortRanges(p.ports, port)
+}
+
+// expand 将模板中的 $1 ~ $9 替换为捕获组，并去掉不可打印的字符
+func expand(pattern *regexp.Regexp, template, text string, groups []int) string {
+	if template == "" {
+		return ""
+	}
+	value := string(pattern.ExpandString(nil, template, text, groups))
+	return strings.Map(func(r rune) rune {
+		if r < 0x20 || r >= 0x7f && r < 0xa0 {
+			return -1
+		}
+		return r
+	}, strings.TrimSpace(value))
+}
+
+// latin1 将字节序列转换为每个字节对应一个码点的字符串
+func latin1(data []byte) string {
+	runes := make([]rune, len(data))
+	for i, c := range data {
+		runes[i] = rune(c)
+	}
+	return string(runes)
+}
+
+// load 解析探测库，source 用于错误信息
+func (db *Database) load(r io.Reader, source string) error {
+	var probe *Probe
+	scanner := bufio.NewScanner(r)
+	for lineNo := 1; scanner.Scan(); lineNo++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		directive, rest, _ := strings.Cut(line, " ")
+		rest = strings.TrimSpace(rest)
+
+		var err error
+		switch directive {
+		case "Probe":
+			probe, err = db.parseProbe(rest)
+		case "ports":
+			if probe == nil {
+				err = fmt.Errorf("ports 必须位于 Probe 之后")
+				break
+			}
+			err = probe.parsePorts(rest)
+		case "match":
+			if probe == nil {
+				err = fmt.Errorf("match 必须位于 Probe 之后")
+				break
+			}
+			var m *match
+			if m, err = parseMatch(rest); err == nil {
+				probe.matches = append(probe.matches, m)
+			}
+		default:
+			err = fmt.Errorf("未知的指令: %s", directive)
+		}
+
+		if err != nil {
+			return fmt.Errorf("%s 第 %d 行: %w", source, lineNo, err)
+		}
+	}
+
+	return scanner.Err()
+}
+
+// parseProbe 解析 "TCP 名称 q|载荷|"，同协议、同名称的探测已存在时返回已有的探测
+func (db *Database) parseProbe(s string) (*Probe, error) {
+	fields := strings.SplitN(s, " ", 3)
+	if len(fields) != 3 {
+		return nil, fmt.Errorf("无效的 Probe: %s", s)
+	}
+
+	protocol := strings.ToLower(fields[0])
+	if protocol != "tcp" && protocol != "udp" {
+		return nil, fmt.Errorf("不支持的协议: %s", fields[0])
+	}
+
+	if !strings.HasPrefix(fields[2], "q") {
+		return nil, fmt.Errorf("无效的探测载荷: %s", fields[2])
+	}
+	payload, rest, err := cutDelimited(fields[2][1:])
+	if err != nil || strings.TrimSpace(rest) != "" {
+		return nil, fmt.Errorf("无效的探测载荷: %s", fields[2])
+	}
+	data, err := unescape(payload)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, probe := range db.probes {
+		if probe.Protocol == protocol && probe.Name == fields[1] {
+			return probe, nil
+		}
+	}
+
+	probe := &Probe{Protocol: protocol, Name: fields[1], Payload: data}
+	db.probes = append(db.probes, probe)
+	return probe, nil
+}
+
+// parsePorts 解析探测适用的端口
+func (p *Probe) parsePorts(s string) error {
+	ports, err := parsePortRanges(s)
+	if err != nil {
+		return err
+	}
+	p.ports = append(p.ports, ports...)
+	return nil
+}
+
+// parsePortRanges 解析逗号分隔的端口和端口范围
+func parsePortRanges(s string) ([][2]int, error) {
+	var ports [][2]int
+	for _, part := range strings.Split(s, ",") {
+		first, last, isRange := strings.Cut(strings.TrimSpace(part), "-")
+		if !isRange {
+			last = first
+		}
+
+		start, err1 := strconv.Atoi(first)
+		end, err2 := strconv.Atoi(last)
+		if err1 != nil || err2 != nil || start < 1 || end > 65535 || start > end {
+			return nil, fmt.Errorf("无效的端口: %s", part)
+		}
+		ports = append(ports, [2]int{start, end})
+	}
+	return ports, nil
+}
+
+// inPortRanges 判断端口是否在端口范围内
+func inPortRanges(ranges [][2]int, port int) bool {
+	for _, r := range ranges {
+		if port >= r[0] && port <= r[1] {
+			return true
+		}
+	}
+	return false
+}
+
+// parseMatch 解析 "服务 m|正则|标志 p/产品/ v/版本/"
+func parseMatch(s string) (*match, error) {
+	service, rest, _ := strings.Cut(s, " ")
+	rest = strings.TrimSpace(rest)
+	if service == "" || !strings.HasPrefix(rest, "m") {
+		return nil, fmt.Errorf("无效的 match: %s", s)
+	}
+
+	expr, rest, err := cutDelimited(rest[1:])
+	if err != nil {
+		return nil, fmt.Errorf("无效的 match: %s", s)
+	}
+
+	// 正则之后紧跟的标志
+	flags := ""
+	for rest != "" && (rest[0] == 'i' || rest[0] == 's') {
+		flags += rest[:1]
+		rest = rest[1:]
+	}
+	if flags != "" {
+		expr = "(?" + flags + ")" + expr
+	}
+
+	pattern, err := regexp.Compile(expr)
+	if err != nil {
+		return nil, fmt.Errorf("无效的正则表达式: %w", err)
+	}
+	m := &match{service: service, pattern: pattern}
+
+	// 产品和版本字段
+	for rest = strings.TrimSpace(rest); rest != ""; rest = strings.TrimSpace(rest) {
+		var value string
+		field := rest[0]
+		if value, rest, err = cutDelimited(rest[1:]); err != nil {
+			return nil, fmt.Errorf("无效的 match 字段: %s", rest)
+		}
+
+		switch field {
+		case 'p':
+			m.product = value
+		case 'v':
+			m.version = value
+		default:
+			return nil, fmt.Errorf("不支持的 match 字段: %c", field)
+		}
+	}
+	return m, nil
+}
+
+// cutDelimited 以首字符为分隔符取出分隔符之间的内容，返回内容和剩余部分
+func cutDelimited(s string) (string, string, error) {
+	if s == "" {
+		return "", "", fmt.Errorf("缺少分隔符")
+	}
+	delim, size := utf8.DecodeRuneInString(s)
+	value, rest, ok := strings.Cut(s[size:], string(delim))
+	if !ok {
+		return "", "", fmt.Errorf("缺少结束分隔符 %c", delim)
+	}
+	return value, rest, nil
+}
+
+// unescape 解析载荷中的 \r \n \t \0 \\ 和 \xNN 转义
+func unescape(s string) ([]byte, error) {
+	var data []byte
+	for i := 0; i < len(s); i++ {
+		if s[i] != '\\' {
+			data = append(data, s[i])
+			continue
+		}
+
+		if i+1 >= len(s) {
+			return nil, fmt.Errorf("无效的转义: %s", s)
+		}
+		i++
+		switch s[i] {
+		case 'r':
+			data = append(data, '\r')
+		case 'n':
+			data = append(data, '\n')
+		case 't':
+			data = append(data, '\t')
+		case '0':
+			data = append(data, 0)
+		case '\\':
+			data = append(data, '\\')
+		case 'x':
+			if i+2 >= len(s) {
+				return nil, fmt.Errorf("无效的转义: %s", s)
+			}
+			c, err := strconv.ParseUint(s[i+1:i+3], 16, 8)
+			if err != nil {
+				return nil, fmt.Errorf("无效的转义: %s", s)
+			}
+			data = append(data, byte(c))
+			i += 2
+		default:
+			return nil, fmt.Errorf("无效的转义: \\%c", s[i])
+		}
+	}
+	return data, nil
+}
@@ -0,0 +1,147 @@
+package service
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestDefaultProbes(t *testing.T) {
+	db := &Database{}
+	if err := db.load(strings.NewReader(defaultProbes), "内置探测库"); err != nil {
+		t.Fatalf("解析内置探测库错误: %v", err)
+	}
+	if len(db.probes) == 0 {
+		t.Fatal("内置探测库没有探测")
+	}
+	for _, probe := range db.probes {
+		if probe.Protocol != "tcp" && probe.Protocol != "udp" {
+			t.Errorf("探测 %s 的协议为 %q", probe.Name, probe.Protocol)
+		}
+	}
+}
+
+func TestDatabaseMatch(t *testing.T) {
+	db, err := New("")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	probes := db.Probes("tcp", 22)
+	if len(probes) == 0 || probes[0].Name != "NULL" {
+		t.Fatalf("TCP 探测应以 NULL 探测开始，得到 %d 个探测", len(probes))
+	}
+
+	tests := []struct {
+		response string
+		want     Info
+		ok       bool
+	}{
+		{response: "SSH-2.0-OpenSSH_8.9p1 Ubuntu-3\r\n", want: Info{Service: "ssh", Product: "OpenSSH", Version: "8.9p1"}, ok: true},
+		{response: "220 (vsFTPd 3.0.5)\r\n", want: Info{Service: "ftp", Product: "vsftpd", Version: "3.0.5"}, ok: true},
+		{response: "\x00\x01\x02", ok: false},
+		{response: "", ok: false},
+	}
+	for _, tt := range tests {
+		got, ok := db.Match(probes[0], []byte(tt.response))
+		if ok != tt.ok || got != tt.want {
+			t.Errorf("Match(%q) = %+v, %v，期望 %+v, %v", tt.response, got, ok, tt.want, tt.ok)
+		}
+	}
+}
+
+func TestDatabaseLoadFile(t *testing.T) {
+	// 文件中的匹配规则优先于内置规则，同名探测合并
+	file := filepath.Join(t.TempDir(), "probes.txt")
+	content := "Probe TCP NULL q||\nmatch custom-ssh m|^SSH-2\\.0-Custom_([\\d.]+)| p/Custom/ v/$1/\n"
+	if err := os.WriteFile(file, []byte(content), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	db, err := New(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var nulls int
+	for _, probe := range db.probes {
+		if probe.Protocol == "tcp" && probe.Name == "NULL" {
+			nulls++
+		}
+	}
+	if nulls != 1 {
+		t.Errorf("同名的 NULL 探测应合并，得到 %d 个", nulls)
+	}
+
+	info, ok := db.Match(db.Probes("tcp", 22)[0], []byte("SSH-2.0-Custom_1.2\r\n"))
+	if !ok || info != (Info{Service: "custom-ssh", Product: "Custom", Version: "1.2"}) {
+		t.Errorf("Match = %+v, %v", info, ok)
+	}
+}
+
+func TestDatabaseLoadMalformed(t *testing.T) {
+	tests := []struct {
+		name  string
+		input string
+	}{
+		{name: "未知指令", input: "Probe TCP NULL q||\nfoo bar"},
+		{name: "ports 在 Probe 之前", input: "ports 80"},
+		{name: "match 在 Probe 之前", input: "match http m|^HTTP|"},
+		{name: "Probe 缺少载荷", input: "Probe TCP NULL"},
+		{name: "不支持的协议", input: "Probe SCTP NULL q||"},
+		{name: "载荷缺少 q", input: "Probe TCP Get |GET|"},
+		{name: "载荷缺少结束分隔符", input: "Probe TCP Get q|GET"},
+		{name: "载荷后有多余内容", input: "Probe TCP Get q|GET| extra"},
+		{name: "无效的转义", input: "Probe TCP Get q|\\q|"},
+		{name: "截断的十六进制转义", input: "Probe TCP Get q|\\x4|"},
+		{name: "无效的端口", input: "Probe TCP Get q|GET|\nports 0"},
+		{name: "颠倒的端口范围", input: "Probe TCP Get q|GET|\nports 90-80"},
+		{name: "match 缺少 m", input: "Probe TCP NULL q||\nmatch http |^HTTP|"},
+		{name: "match 缺少结束分隔符", input: "Probe TCP NULL q||\nmatch http m|^HTTP"},
+		{name: "无效的正则", input: "Probe TCP NULL q||\nmatch http m|^(HTTP|"},
+		{name: "不支持的 match 字段", input: "Probe TCP NULL q||\nmatch http m|^HTTP| x/foo/"},
+		{name: "match 字段缺少结束分隔符", input: "Probe TCP NULL q||\nmatch http m|^HTTP| p/foo"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db := &Database{}
+			err := db.load(strings.NewReader(tt.input), "test")
+			if err == nil {
+				t.Fatalf("解析 %q 应返回错误", tt.input)
+			}
+			if !strings.HasPrefix(err.Error(), "test 第 ") {
+				t.Errorf("错误信息应包含来源和行号: %v", err)
+			}
+		})
+	}
+}
+
+func TestUnescape(t *testing.T) {
+	tests := []struct {
+		in      string
+		want    string
+		wantErr bool
+	}{
+		{in: "GET / HTTP/1.0\\r\\n\\r\\n", want: "GET / HTTP/1.0\r\n\r\n"},
+		{in: "\\x00\\xffa\\t\\0\\\\", want: "\x00\xffa\t\x00\\"},
+		{in: "", want: ""},
+		{in: "\\", wantErr: true},
+		{in: "\\xg0", wantErr: true},
+		{in: "\\x1", wantErr: true},
+		{in: "\\z", wantErr: true},
+	}
+	for _, tt := range tests {
+		got, err := unescape(tt.in)
+		if tt.wantErr {
+			if err == nil {
+				t.Errorf("unescape(%q) 应返回错误", tt.in)
+			}
+			continue
+		}
+		if err != nil || string(got) != tt.want {
+			t.Errorf("unescape(%q) = %q, %v，期望 %q", tt.in, got, err, tt.want)
+		}
+	}
+}
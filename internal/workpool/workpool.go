@@ -0,0 +1,54 @@
+package workpool
+
+import (
+	"context"
+	"iter"
+	"sync"
+)
+
+// Run 使用固定数量的工作协程处理惰性生成的任务序列，并通过通道流式返回结果
+// 任务按需从 jobs 中取出，内存占用与任务总数无关
+// work 返回 false 时丢弃该结果；上下文取消后不再取出新任务，所有工作协程退出后关闭结果通道
+// 调用方必须读完结果通道，否则工作协程会阻塞
+func Run[J, R any](ctx context.Context, jobs iter.Seq[J], concurrency int, work func(context.Context, J) (R, bool)) <-chan R {
+	if concurrency < 1 {
+		concurrency = 1
+	}
+
+	jobsChan := make(chan J)
+	results := make(chan R, concurrency)
+
+	// 按需取出任务，上下文取消后停止派发
+	go func() {
+		defer close(jobsChan)
+		for job := range jobs {
+			select {
+			case jobsChan <- job:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+
+	// 启动固定数量的工作协程
+	var wg sync.WaitGroup
+	for i := 0; i < concurrency; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for job := range jobsChan {
+				if result, ok := work(ctx, job); ok {
+					results <- result
+				}
+			}
+		}()
+	}
+
+	// 等待所有工作协程完成后关闭结果通道
+	go func() {
+		wg.Wait()
+		close(results)
+	}()
+
+	return results
+}
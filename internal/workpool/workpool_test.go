@@ -0,0 +1,130 @@
+package workpool
+
+import (
+	"context"
+	"slices"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// count 生成 0 到 n-1 的任务序列，n 为负数时无限生成；pulled 记录已取出的任务数
+func count(n int, pulled *atomic.Int64) func(yield func(int) bool) {
+	return func(yield func(int) bool) {
+		for i := 0; n < 0 || i < n; i++ {
+			pulled.Add(1)
+			if !yield(i) {
+				return
+			}
+		}
+	}
+}
+
+func TestRun(t *testing.T) {
+	tests := []struct {
+		name        string
+		jobs        int
+		concurrency int
+	}{
+		{name: "单个工作协程", jobs: 100, concurrency: 1},
+		{name: "多个工作协程", jobs: 1000, concurrency: 8},
+		{name: "工作协程多于任务", jobs: 3, concurrency: 16},
+		{name: "并发数小于 1 时按 1 处理", jobs: 10, concurrency: 0},
+		{name: "没有任务", jobs: 0, concurrency: 4},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var pulled atomic.Int64
+			var running, peak atomic.Int64
+			results := Run(context.Background(), count(tt.jobs, &pulled), tt.concurrency, func(_ context.Context, job int) (int, bool) {
+				n := running.Add(1)
+				for {
+					p := peak.Load()
+					if n <= p || peak.CompareAndSwap(p, n) {
+						break
+					}
+				}
+				time.Sleep(time.Millisecond / 10)
+				running.Add(-1)
+				// 丢弃奇数任务的结果
+				return job, job%2 == 0
+			})
+
+			var got []int
+			for result := range results {
+				got = append(got, result)
+			}
+			slices.Sort(got)
+
+			var want []int
+			for i := 0; i < tt.jobs; i += 2 {
+				want = append(want, i)
+			}
+			if !slices.Equal(got, want) {
+				t.Errorf("得到 %d 个结果，期望 %d 个", len(got), len(want))
+			}
+			if limit := int64(max(tt.concurrency, 1)); peak.Load() > limit {
+				t.Errorf("同时运行 %d 个任务，超过并发数 %d", peak.Load(), limit)
+			}
+		})
+	}
+}
+
+func TestRunCanceled(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	// 无限的任务序列：取消后不再取出任务，结果通道关闭
+	var pulled atomic.Int64
+	results := Run(ctx, count(-1, &pulled), 4, func(ctx context.Context, job int) (int, bool) {
+		if job == 10 {
+			cancel()
+		}
+		return job, true
+	})
+
+	done := make(chan int)
+	go func() {
+		n := 0
+		for range results {
+			n++
+		}
+		done <- n
+	}()
+
+	select {
+	case n := <-done:
+		// 取消前的任务都已执行，取消后派发协程很快停止
+		if n < 11 || n > 1000 {
+			t.Errorf("取消后得到 %d 个结果", n)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("上下文取消后结果通道没有关闭")
+	}
+}
+
+func TestRunLazy(t *testing.T) {
+	// 任务按需取出：工作协程阻塞时只会多取出少量任务
+	var pulled atomic.Int64
+	release := make(chan struct{})
+	results := Run(context.Background(), count(1000, &pulled), 2, func(_ context.Context, job int) (int, bool) {
+		<-release
+		return job, true
+	})
+
+	time.Sleep(50 * time.Millisecond)
+	// 2 个工作协程各持有 1 个任务，派发协程最多再取出 1 个等待发送
+	if n := pulled.Load(); n > 3 {
+		t.Errorf("工作协程阻塞时取出了 %d 个任务", n)
+	}
+
+	close(release)
+	n := 0
+	for range results {
+		n++
+	}
+	if n != 1000 {
+		t.Errorf("得到 %d 个结果，期望 1000", n)
+	}
+}
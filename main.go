@@ -1,14 +1,32 @@
 package main
 
 import (
+	"context"
 	"fmt"
 	"os"
+	"os/signal"
+	"syscall"
 
 	"github.com/ezra-sullivan/net-sniff/pkg/cmd"
+	"github.com/ezra-sullivan/net-sniff/pkg/cmd/scan"
 )
 
 func main() {
-	if err := cmd.NewNetSniffCommand().Execute(); err != nil {
+	// 收到中断信号时取消上下文，命令会停止派发任务并输出已完成部分的总结
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	// 第一次中断后恢复默认的信号处理，再次按下 Ctrl-C 可强制退出
+	go func() {
+		<-ctx.Done()
+		stop()
+	}()
+
+	rootCmd := cmd.NewNetSniffCommand()
+	// 支持 nmap 风格的 -Pn
+	rootCmd.SetArgs(scan.NormalizeArgs(rootCmd, os.Args[1:]))
+
+	if err := rootCmd.ExecuteContext(ctx); err != nil {
 		_, err := fmt.Fprintf(os.Stderr, "错误: %v\n", err)
 		if err != nil {
 			return
@@ -1,10 +1,13 @@
 package ping
 
 import (
+	"context"
 	"fmt"
 	"github.com/ezra-sullivan/net-sniff/internal/global"
 	"github.com/ezra-sullivan/net-sniff/internal/initialize/logger"
 	"github.com/ezra-sullivan/net-sniff/internal/initialize/options"
+	"github.com/ezra-sullivan/net-sniff/internal/resolve"
+	"github.com/ezra-sullivan/net-sniff/internal/retry"
 	"time"
 
 	"github.com/ezra-sullivan/net-sniff/internal/ping"
@@ -31,11 +34,31 @@ func NewCmdPing(opts *options.Options) *cobra.Command {
 				}
 			}()
 
+			// 未指定主机列表且标准输入来自管道时，从标准输入读取
+			if opts.Hosts == "" && utils.StdinIsPipe() {
+				opts.Hosts = utils.Stdin
+			}
+
 			// 检查主机列表是否为空
 			if opts.Hosts == "" {
 				return fmt.Errorf("必须指定主机列表")
 			}
-			return runPing(opts)
+
+			// 检查发送包数和间隔
+			if opts.PingCount < 1 || opts.PingInterval <= 0 {
+				return fmt.Errorf("--count 必须大于 0，--interval 必须大于 0")
+			}
+
+			// 特权模式和非特权模式只能指定一个
+			if opts.Privileged && opts.Unprivileged {
+				return fmt.Errorf("--privileged 不能与 --unprivileged 同时使用")
+			}
+			err := runPing(cmd.Context(), opts)
+			// 被中断时不输出用法说明
+			if cmd.Context().Err() != nil {
+				cmd.SilenceUsage = true
+			}
+			return err
 		},
 	}
 
@@ -47,37 +70,89 @@ func NewCmdPing(opts *options.Options) *cobra.Command {
 
 // addFlags 添加命令特定的标志
 func addFlags(cmd *cobra.Command, opts *options.Options) {
-	cmd.Flags().StringVarP(&opts.Hosts, "hosts", "H", "", "主机列表，逗号分隔或文件路径")
+	cmd.Flags().StringVarP(&opts.Hosts, "hosts", "H", "", "主机列表，逗号分隔、文件路径或 - (标准输入)")
+	cmd.Flags().IntVar(&opts.PingCount, "count", 1, "每个主机发送的包数，大于 1 时统计丢包率、最小/平均/最大往返时间、标准差和抖动")
+	cmd.Flags().IntVar(&opts.PingInterval, "interval", 1000, "发送多个包时两个包之间的间隔（毫秒）")
+	cmd.Flags().IntVar(&opts.PingRetries, "retries", 0, "没有收到任何回复时的重试次数")
+	cmd.Flags().BoolVar(&opts.Privileged, "privileged", false, "使用原始套接字 ping（需要 root 权限或 CAP_NET_RAW），默认自动检测")
+	cmd.Flags().BoolVar(&opts.Unprivileged, "unprivileged", false, "使用 ICMP 数据报套接字 ping（Linux 需要用户组在 net.ipv4.ping_group_range 范围内），默认自动检测")
 }
 
 // runPing 执行 ping 命令
-func runPing(opts *options.Options) error {
+func runPing(ctx context.Context, opts *options.Options) error {
 	// 解析主机列表
 
 	consoleLogger := global.ConsoleLogger
 
-	hostList, err := utils.ParseHostList(opts.Hosts)
+	targets, err := utils.ParseTargets(opts.Hosts)
 	if err != nil {
 		consoleLogger.Error("解析主机列表错误", "error", err)
 		return err
 	}
 
-	logger.OutputStart("Ping", len(hostList), 0)
+	// 排除不需要扫描的主机
+	excluded, err := utils.ParseExcludes(opts.Exclude, opts.ExcludeFile)
+	if err != nil {
+		consoleLogger.Error("解析排除列表错误", "error", err)
+		return err
+	}
+	targets.Exclude(excluded)
+	if targets.Len() == 0 {
+		return fmt.Errorf("排除后没有剩余的主机")
+	}
 
-	// 执行批量 Ping，传入超时参数
-	results := ping.BatchPing(hostList, opts.Concurrency, time.Duration(opts.Timeout)*time.Millisecond)
+	// 创建域名解析器，每个主机名只解析一次
+	resolver, err := resolve.New(opts.Resolver, opts.AllAddrs, opts.ResolveNames)
+	if err != nil {
+		consoleLogger.Error("创建域名解析器错误", "error", err)
+		return err
+	}
+
+	// 没有收到回复时按重试策略重试
+	retries := retry.NewPolicy(opts.PingRetries, time.Duration(opts.RetryBackoff)*time.Millisecond)
+
+	// 确定使用特权模式还是非特权模式，都不可用时说明缺少的权限或配置
+	privileged, err := ping.Privileged(opts.Privileged, opts.Unprivileged)
+	if err != nil {
+		consoleLogger.Error("无法执行 Ping", "error", err)
+		return err
+	}
 
-	// 统计结果
-	successCount := 0
-	for _, result := range results {
+	// 每个主机发送的包数
+	config := &ping.Config{
+		Count:      opts.PingCount,
+		Interval:   time.Duration(opts.PingInterval) * time.Millisecond,
+		Privileged: privileged,
+	}
+
+	// 结果文件第一行为列名
+	logger.OutputFileHeader(ping.Columns)
+
+	logger.OutputStart("Ping", targets.Len(), 0)
+
+	// 执行批量 Ping，结果到达即统计，不保留全部结果
+	completed, successCount, sent, recv := 0, 0, 0, 0
+	for result := range ping.StreamPing(ctx, resolver, targets.All(), opts.Concurrency, time.Duration(opts.Timeout)*time.Millisecond, retries, config) {
+		completed++
 		if result.Success {
 			successCount++
 		}
+		sent += result.PacketsSent
+		recv += result.PacketsRecv
+	}
 
+	// 输出总结信息，发送多个包时包括总的丢包率
+	if config.Count > 1 {
+		logger.OutputPingSummary("Ping", successCount, completed, sent, recv)
+	} else {
+		logger.OutputSummary("Ping", successCount, completed)
 	}
 
-	// 输出总结信息
-	logger.OutputSummary("Ping", successCount, len(results))
+	// 被中断时提示仅统计了已完成的部分
+	if runErr := ctx.Err(); runErr != nil {
+		consoleLogger.Warn("Ping 已中断，仅统计已完成的部分", "completed", completed, "total", targets.Len())
+		return fmt.Errorf("Ping 已中断: %w", runErr)
+	}
 
 	return nil
 }
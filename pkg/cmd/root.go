@@ -3,7 +3,9 @@ package cmd
 import (
 	"github.com/ezra-sullivan/net-sniff/internal/global"
 	"github.com/ezra-sullivan/net-sniff/internal/initialize"
+	"github.com/ezra-sullivan/net-sniff/internal/initialize/logger"
 	"github.com/ezra-sullivan/net-sniff/pkg/cmd/ping"
+	"github.com/ezra-sullivan/net-sniff/pkg/cmd/scan"
 	"github.com/ezra-sullivan/net-sniff/pkg/cmd/tcp"
 	"github.com/ezra-sullivan/net-sniff/pkg/cmd/udp"
 	"github.com/spf13/cobra"
@@ -26,9 +28,17 @@ func NewRootCmd() *cobra.Command {
 	rootCmd := &cobra.Command{
 		Use:           "net-sniff",
 		Short:         "网络探测工具",
-		Long:          `网络探测工具，支持批量 Ping、TCP/UDP 端口扫描等功能。`,
+		Long:          `网络探测工具，支持批量 Ping、TCP/UDP 端口扫描、主机发现与端口扫描组合等功能。`,
 		SilenceUsage:  false,
 		SilenceErrors: false,
+		PersistentPreRunE: func(cmd *cobra.Command, args []string) error {
+			// 解析命令行参数后设置日志级别和输出文件
+			return logger.Setup(opts)
+		},
+		PersistentPostRunE: func(cmd *cobra.Command, args []string) error {
+			// 关闭输出文件
+			return logger.Close()
+		},
 		RunE: func(cmd *cobra.Command, args []string) error {
 			// 如果是根命令直接执行，则显示帮助信息
 			return cmd.Help()
@@ -37,7 +47,13 @@ func NewRootCmd() *cobra.Command {
 
 	// 添加全局标志
 	rootCmd.PersistentFlags().IntVarP(&opts.Timeout, "timeout", "t", 1000, "超时时间（毫秒）")
+	rootCmd.PersistentFlags().IntVar(&opts.RetryBackoff, "retry-backoff", 100, "第一次重试前等待的时间（毫秒），之后每次重试翻倍，最长 10 秒")
 	rootCmd.PersistentFlags().IntVarP(&opts.Concurrency, "concurrency", "c", 100, "并发数")
+	rootCmd.PersistentFlags().StringVar(&opts.Exclude, "exclude", "", "排除的主机，格式与主机列表相同")
+	rootCmd.PersistentFlags().StringVar(&opts.ExcludeFile, "exclude-file", "", "排除的主机列表文件")
+	rootCmd.PersistentFlags().StringVar(&opts.Resolver, "resolver", "", "DNS 服务器地址，如 1.1.1.1:53，默认使用系统解析器")
+	rootCmd.PersistentFlags().BoolVar(&opts.AllAddrs, "all-addrs", false, "探测主机名解析得到的全部地址，默认只探测第一个")
+	rootCmd.PersistentFlags().BoolVar(&opts.ResolveNames, "resolve-names", false, "反向解析存活主机和开放端口所在 IP 地址的主机名")
 	rootCmd.PersistentFlags().StringVarP(&opts.OutputFile, "output", "o", "", "输出文件路径")
 	rootCmd.PersistentFlags().BoolVarP(&opts.Verbose, "verbose", "v", false, "详细模式")
 	rootCmd.PersistentFlags().StringVarP(&opts.LogLevel, "log-level", "l", "info", "日志级别: debug, info, warn, error")
@@ -46,6 +62,7 @@ func NewRootCmd() *cobra.Command {
 	rootCmd.AddCommand(ping.NewCmdPing(opts))
 	rootCmd.AddCommand(tcp.NewCmdTCP(opts))
 	rootCmd.AddCommand(udp.NewCmdUDP(opts))
+	rootCmd.AddCommand(scan.NewCmdScan(opts))
 
 	return rootCmd
 }
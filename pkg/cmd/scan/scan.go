@@ -0,0 +1,381 @@
+package scan
+
+import (
+	"context"
+	"fmt"
+	"github.com/ezra-sullivan/net-sniff/internal/global"
+	"github.com/ezra-sullivan/net-sniff/internal/initialize/logger"
+	"github.com/ezra-sullivan/net-sniff/internal/initialize/options"
+	"github.com/ezra-sullivan/net-sniff/internal/ping"
+	"github.com/ezra-sullivan/net-sniff/internal/pscan"
+	"github.com/ezra-sullivan/net-sniff/internal/report"
+	"github.com/ezra-sullivan/net-sniff/internal/resolve"
+	"github.com/ezra-sullivan/net-sniff/internal/retry"
+	"github.com/ezra-sullivan/net-sniff/internal/service"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/ezra-sullivan/net-sniff/pkg/utils"
+	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
+)
+
+// SkipPingFlag 跳过主机发现的标志名，与 nmap 的 -Pn 相同
+const SkipPingFlag = "Pn"
+
+// NormalizeArgs 将 scan 命令参数中 nmap 风格的 -Pn 转换为 --Pn，pflag 的单横线简写只支持单个字符
+// 只转换处于标志位置的 -Pn，作为其他标志的值或位于 -- 之后时保持不变；root 为根命令，args 不含程序名
+func NormalizeArgs(root *cobra.Command, args []string) []string {
+	cmd, _, err := root.Find(args)
+	if err != nil || cmd.Name() != "scan" {
+		return args
+	}
+
+	normalized := slices.Clone(args)
+	for i := 0; i < len(normalized); i++ {
+		arg := normalized[i]
+		switch {
+		case arg == "--":
+			// 之后都是位置参数
+			return normalized
+		case arg == "-"+SkipPingFlag:
+			normalized[i] = "--" + SkipPingFlag
+		case takesValue(cmd, arg):
+			// 跳过标志的值
+			i++
+		}
+	}
+	return normalized
+}
+
+// takesValue 检查 arg 是否为需要由下一个参数提供值的标志（如 --exclude、-p、-vp）
+func takesValue(cmd *cobra.Command, arg string) bool {
+	if name, ok := strings.CutPrefix(arg, "--"); ok {
+		if strings.Contains(name, "=") {
+			return false
+		}
+		flag := lookupFlag(cmd, func(fs *pflag.FlagSet) *pflag.Flag { return fs.Lookup(name) })
+		return flag != nil && flag.NoOptDefVal == ""
+	}
+
+	shorthands, ok := strings.CutPrefix(arg, "-")
+	if !ok {
+		return false
+	}
+	// 组合的单字符标志：需要值的标志之后的字符是它的值，位于末尾时值在下一个参数中
+	for i, c := range shorthands {
+		flag := lookupFlag(cmd, func(fs *pflag.FlagSet) *pflag.Flag { return fs.ShorthandLookup(string(c)) })
+		if flag == nil {
+			return false
+		}
+		if flag.NoOptDefVal == "" {
+			return i == len(shorthands)-1
+		}
+	}
+	return false
+}
+
+// lookupFlag 在命令自身和继承的标志中查找
+func lookupFlag(cmd *cobra.Command, lookup func(*pflag.FlagSet) *pflag.Flag) *pflag.Flag {
+	if flag := lookup(cmd.Flags()); flag != nil {
+		return flag
+	}
+	return lookup(cmd.InheritedFlags())
+}
+
+// NewCmdScan 创建 scan 命令
+func NewCmdScan(opts *options.Options) *cobra.Command {
+
+	consoleLogger := global.ConsoleLogger
+	cmd := &cobra.Command{
+		Use:   "scan",
+		Short: "主机发现 + TCP/UDP 端口扫描",
+		Long: `先通过 Ping 发现存活主机（-Pn 跳过），再对存活主机执行 TCP 和 UDP 端口扫描，最后按主机输出合并报告。
+端口列表支持 T:/U: 协议前缀，没有前缀的端口同时用于 TCP 和 UDP 扫描。`,
+		SilenceUsage:  false,
+		SilenceErrors: true,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			// 添加 panic 恢复机制
+			defer func() {
+				if r := recover(); r != nil {
+					consoleLogger.Error("命令执行过程中发生严重错误", "error", r)
+				}
+			}()
+
+			// 未指定主机列表、端口列表不从标准输入读取且标准输入来自管道时，从标准输入读取主机列表
+			if opts.Hosts == "" && opts.Ports != utils.Stdin && utils.StdinIsPipe() {
+				opts.Hosts = utils.Stdin
+			}
+
+			// 检查主机列表是否为空
+			if opts.Hosts == "" {
+				return fmt.Errorf("必须指定主机列表")
+			}
+
+			// 检查端口列表是否为空
+			if opts.Ports == "" && opts.TopPorts == 0 {
+				return fmt.Errorf("必须指定端口列表")
+			}
+
+			// 检查端口列表与标准输入的用法
+			if err := utils.CheckPortsStdin(opts.Hosts, opts.Ports); err != nil {
+				return err
+			}
+
+			// 端口列表和常用端口只能指定一个
+			if opts.Ports != "" && opts.TopPorts > 0 {
+				return fmt.Errorf("--top-ports 不能与 --ports 同时使用")
+			}
+
+			// 特权模式和非特权模式只能指定一个
+			if opts.Privileged && opts.Unprivileged {
+				return fmt.Errorf("--privileged 不能与 --unprivileged 同时使用")
+			}
+
+			// 单一载荷和自定义载荷库只能指定一个
+			if opts.UDPPayload != "" && opts.UDPPayloads != "" {
+				return fmt.Errorf("--udp-payload 不能与 --udp-payloads 同时使用")
+			}
+
+			// 检查扫描模式
+			if err := pscan.CheckMode(opts.Mode); err != nil {
+				return err
+			}
+
+			err := runScan(cmd.Context(), opts)
+			// 被中断时不输出用法说明
+			if cmd.Context().Err() != nil {
+				cmd.SilenceUsage = true
+			}
+			return err
+		},
+	}
+
+	// 添加命令特定的标志
+	addFlags(cmd, opts)
+
+	return cmd
+}
+
+// addFlags 添加命令特定的标志
+func addFlags(cmd *cobra.Command, opts *options.Options) {
+	cmd.Flags().StringVarP(&opts.Hosts, "hosts", "H", "", "主机列表，逗号分隔、范围、文件路径或 - (标准输入)")
+	cmd.Flags().StringVarP(&opts.Ports, "ports", "p", "", "端口列表，格式与 tcp/udp 命令相同（all 表示全部端口，- 表示从标准输入读取），T:/U: 前缀指定协议，没有前缀的端口同时用于 TCP 和 UDP")
+	cmd.Flags().IntVar(&opts.TopPorts, "top-ports", 0, fmt.Sprintf("扫描最常用的 N 个 TCP 端口和 N 个 UDP 端口，内置列表分别有 %d 和 %d 个端口，N 超过列表长度时扫描整个列表", utils.TopPortsLimit("tcp"), utils.TopPortsLimit("udp")))
+	cmd.Flags().StringVar(&opts.ExcludePorts, "exclude-ports", "", "排除的端口列表，格式与 --ports 相同")
+	cmd.Flags().StringVar(&opts.Mode, "mode", pscan.ModeConnect, "TCP 扫描模式，connect (完整连接) 或 syn (半开放扫描，需要 Linux 和 root 权限，否则改用 connect)")
+	cmd.Flags().IntVar(&opts.PingRetries, "ping-retries", 0, "主机发现没有收到回复时的重试次数")
+	cmd.Flags().BoolVar(&opts.Privileged, "privileged", false, "主机发现使用原始套接字 ping（需要 root 权限或 CAP_NET_RAW），默认自动检测")
+	cmd.Flags().BoolVar(&opts.Unprivileged, "unprivileged", false, "主机发现使用 ICMP 数据报套接字 ping（Linux 需要用户组在 net.ipv4.ping_group_range 范围内），默认自动检测")
+	cmd.Flags().IntVar(&opts.Retries, "retries", 0, "TCP 连接超时（没有响应）时的重试次数")
+	cmd.Flags().IntVar(&opts.UDPRetries, "udp-retries", 0, "UDP 端口没有响应时重新发送载荷的次数")
+	cmd.Flags().StringVar(&opts.UDPPayload, "udp-payload", "", "对所有 UDP 端口发送的载荷，支持 \\r\\n、\\xNN 等转义，替代内置载荷库")
+	cmd.Flags().StringVar(&opts.UDPPayloads, "udp-payloads", "", "追加的 UDP 载荷库文件，格式与内置载荷库相同，优先于内置载荷")
+	cmd.Flags().BoolVar(&opts.ServiceDetect, "service-detect", false, "识别开放端口的服务和版本，每个探测各自建立连接并最长等待 --timeout")
+	cmd.Flags().StringVar(&opts.ServiceProbes, "service-probes", "", "追加的服务探测库文件，格式与内置探测库相同（隐含 --service-detect）")
+	cmd.Flags().BoolVar(&opts.SkipPing, SkipPingFlag, false, "跳过 Ping 主机发现，扫描全部主机（也可以写作 -Pn）")
+}
+
+// runScan 执行 scan 命令：主机发现、TCP 扫描、UDP 扫描，结束（或中断）后输出合并报告
+func runScan(ctx context.Context, opts *options.Options) error {
+	consoleLogger := global.ConsoleLogger
+	timeout := time.Duration(opts.Timeout) * time.Millisecond
+	backoff := time.Duration(opts.RetryBackoff) * time.Millisecond
+
+	// 创建域名解析器，每个主机名只解析一次，各阶段共享解析结果
+	resolver, err := resolve.New(opts.Resolver, opts.AllAddrs, opts.ResolveNames)
+	if err != nil {
+		consoleLogger.Error("创建域名解析器错误", "error", err)
+		return err
+	}
+
+	// 端口开放后识别服务和版本
+	var services *pscan.ServiceConfig
+	if opts.ServiceDetect || opts.ServiceProbes != "" {
+		db, err := service.New(opts.ServiceProbes)
+		if err != nil {
+			consoleLogger.Error("加载服务探测库错误", "error", err)
+			return err
+		}
+		services = &pscan.ServiceConfig{Database: db, Timeout: timeout}
+	}
+
+	// TCP 端口开放后执行的附加探测
+	var probes *pscan.TCPProbes
+	if services != nil {
+		probes = &pscan.TCPProbes{Service: services}
+	}
+
+	// UDP 载荷：--udp-payload 对所有端口使用同一载荷，--udp-payloads 追加自定义载荷库，否则使用内置载荷库
+	var payloads *service.Payloads
+	if opts.UDPPayload != "" {
+		data, err := utils.ParseProbe(opts.UDPPayload)
+		if err != nil {
+			consoleLogger.Error("解析 UDP 载荷错误", "error", err)
+			return err
+		}
+		payloads = service.FixedPayload(data)
+	} else if opts.UDPPayloads != "" {
+		if payloads, err = service.NewPayloads(opts.UDPPayloads); err != nil {
+			consoleLogger.Error("加载 UDP 载荷库错误", "error", err)
+			return err
+		}
+	}
+
+	// 解析主机列表并排除不需要扫描的主机
+	targets, err := utils.ParseTargets(opts.Hosts)
+	if err != nil {
+		consoleLogger.Error("解析主机列表错误", "error", err)
+		return err
+	}
+
+	excluded, err := utils.ParseExcludes(opts.Exclude, opts.ExcludeFile)
+	if err != nil {
+		consoleLogger.Error("解析排除列表错误", "error", err)
+		return err
+	}
+	targets.Exclude(excluded)
+	if targets.Len() == 0 {
+		return fmt.Errorf("排除后没有剩余的主机")
+	}
+
+	// 解析 TCP 和 UDP 端口
+	spec, err := utils.SelectPortSpec(opts.Ports, opts.TopPorts, opts.ExcludePorts)
+	if err != nil {
+		consoleLogger.Error("解析端口范围错误", "error", err)
+		return err
+	}
+
+	// 扫描过程中不逐条写入结果文件，结束后只写入按主机合并的报告，第一行为列名
+	logger.OutputFileHeader(report.Columns)
+	rep := report.New()
+	fileLogger := global.FileLogger
+	global.FileLogger = nil
+	defer func() {
+		global.FileLogger = fileLogger
+		rep.Output(!opts.SkipPing)
+	}()
+
+	hosts, hostCount := targets.All(), targets.Len()
+
+	// 主机发现，只扫描存活的主机
+	if !opts.SkipPing {
+		// 确定使用特权模式还是非特权模式，都不可用时说明缺少的权限或配置
+		privileged, err := ping.Privileged(opts.Privileged, opts.Unprivileged)
+		if err != nil {
+			consoleLogger.Error("无法执行主机发现，可以使用 -Pn 跳过", "error", err)
+			return err
+		}
+
+		logger.OutputStart("主机发现", hostCount, 0)
+
+		var live []string
+		seen := make(map[string]bool)
+		completed, aliveCount := 0, 0
+		for result := range ping.StreamPing(ctx, resolver, hosts, opts.Concurrency, timeout, retry.NewPolicy(opts.PingRetries, backoff), &ping.Config{Privileged: privileged}) {
+			completed++
+			if result.Success {
+				aliveCount++
+				rep.AddPing(result)
+				// 启用 --all-addrs 时同一主机可能有多个地址存活
+				if !seen[result.Host] {
+					seen[result.Host] = true
+					live = append(live, result.Host)
+				}
+			}
+		}
+
+		logger.OutputSummary("主机发现", aliveCount, completed)
+		if err := interrupted(ctx, "主机发现", completed, hostCount); err != nil {
+			return err
+		}
+
+		if len(live) == 0 {
+			consoleLogger.Info("没有发现存活的主机，可以使用 -Pn 跳过主机发现")
+			return nil
+		}
+		hosts, hostCount = slices.Values(live), len(live)
+	}
+
+	// TCP 端口扫描
+	if len(spec.TCP) > 0 {
+		syn := pscan.NewScannerForMode(opts.Mode)
+		if syn != nil {
+			defer func() {
+				_ = syn.Close()
+			}()
+		}
+
+		results := pscan.StreamScanTCPPorts(ctx, resolver, hosts, spec.TCP, opts.Concurrency, timeout, retry.NewPolicy(opts.Retries, backoff), syn, probes)
+		openCount, filteredCount := 0, 0
+		if err := runStage(ctx, "TCP 扫描", hostCount, len(spec.TCP), results, func(result pscan.TCPScanResult) {
+			rep.AddTCP(result)
+			switch result.State {
+			case pscan.TCP_PORT_OPEN:
+				openCount++
+			case pscan.TCP_PORT_FILTERED:
+				filteredCount++
+			}
+		}, func(completed int) {
+			logger.OutputPortSummary("TCP 扫描", openCount, completed-openCount-filteredCount, filteredCount)
+		}); err != nil {
+			return err
+		}
+	}
+
+	// UDP 端口扫描
+	if len(spec.UDP) > 0 {
+		// 有权限时监听 ICMP 不可达消息，更准确地判断关闭和被过滤的端口
+		icmp := pscan.ListenICMPIfPrivileged()
+		if icmp != nil {
+			defer func() {
+				_ = icmp.Close()
+			}()
+		}
+
+		results := pscan.StreamScanUDPPorts(ctx, resolver, hosts, spec.UDP, opts.Concurrency, timeout, retry.NewPolicy(opts.UDPRetries, backoff), icmp, payloads, services)
+		openCount, closedCount, filteredCount := 0, 0, 0
+		if err := runStage(ctx, "UDP 扫描", hostCount, len(spec.UDP), results, func(result pscan.UDPScanResult) {
+			rep.AddUDP(result)
+			switch result.IsOpen {
+			case pscan.UDP_PORT_OPEN:
+				openCount++
+			case pscan.UDP_PORT_CLOSED:
+				closedCount++
+			case pscan.UDP_PORT_FILTERED:
+				filteredCount++
+			}
+		}, func(completed int) {
+			logger.OutputUDPPortSummary("UDP 扫描", openCount, completed-openCount-closedCount-filteredCount, closedCount, filteredCount)
+		}); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// runStage 读完一个扫描阶段的结果通道，add 记录并统计每个结果，结束后 summary 按完成的数量输出总结
+func runStage[R any](ctx context.Context, name string, hostCount, portCount int, results <-chan R, add func(R), summary func(completed int)) error {
+	logger.OutputStart(name, hostCount, portCount)
+
+	completed := 0
+	for result := range results {
+		completed++
+		add(result)
+	}
+
+	summary(completed)
+	return interrupted(ctx, name, completed, hostCount*portCount)
+}
+
+// interrupted 上下文被取消时提示仅统计了已完成的部分，并返回中断错误
+func interrupted(ctx context.Context, name string, completed, total int) error {
+	runErr := ctx.Err()
+	if runErr == nil {
+		return nil
+	}
+	global.ConsoleLogger.Warn(fmt.Sprintf("%s已中断，仅统计已完成的部分", name), "completed", completed, "total", total)
+	return fmt.Errorf("%s已中断: %w", name, runErr)
+}
@@ -0,0 +1,37 @@
+package scan_test
+
+import (
+	"slices"
+	"testing"
+
+	"github.com/ezra-sullivan/net-sniff/pkg/cmd"
+	"github.com/ezra-sullivan/net-sniff/pkg/cmd/scan"
+)
+
+func TestNormalizeArgs(t *testing.T) {
+	tests := []struct {
+		name string
+		args []string
+		want []string
+	}{
+		{name: "标志位置", args: []string{"scan", "-H", "10.0.0.1", "-Pn"}, want: []string{"scan", "-H", "10.0.0.1", "--Pn"}},
+		{name: "子命令之前", args: []string{"-v", "scan", "-Pn", "-p", "80"}, want: []string{"-v", "scan", "--Pn", "-p", "80"}},
+		{name: "作为长标志的值", args: []string{"scan", "--exclude", "-Pn", "-Pn"}, want: []string{"scan", "--exclude", "-Pn", "--Pn"}},
+		{name: "作为短标志的值", args: []string{"scan", "-H", "-Pn"}, want: []string{"scan", "-H", "-Pn"}},
+		{name: "组合短标志的值", args: []string{"scan", "-vH", "-Pn"}, want: []string{"scan", "-vH", "-Pn"}},
+		{name: "继承的标志的值", args: []string{"scan", "-o", "-Pn", "-Pn"}, want: []string{"scan", "-o", "-Pn", "--Pn"}},
+		{name: "等号形式的值", args: []string{"scan", "--exclude=x", "-Pn"}, want: []string{"scan", "--exclude=x", "--Pn"}},
+		{name: "布尔标志之后", args: []string{"scan", "--service-detect", "-Pn"}, want: []string{"scan", "--service-detect", "--Pn"}},
+		{name: "-- 之后", args: []string{"scan", "--", "-Pn"}, want: []string{"scan", "--", "-Pn"}},
+		{name: "其他子命令", args: []string{"tcp", "-Pn"}, want: []string{"tcp", "-Pn"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := scan.NormalizeArgs(cmd.NewRootCmd(), tt.args)
+			if !slices.Equal(got, tt.want) {
+				t.Errorf("NormalizeArgs(%q) = %q，期望 %q", tt.args, got, tt.want)
+			}
+		})
+	}
+}
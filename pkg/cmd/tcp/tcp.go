@@ -1,10 +1,14 @@
 package tcp
 
 import (
+	"context"
 	"fmt"
 	"github.com/ezra-sullivan/net-sniff/internal/global"
 	"github.com/ezra-sullivan/net-sniff/internal/initialize/logger"
 	"github.com/ezra-sullivan/net-sniff/internal/initialize/options"
+	"github.com/ezra-sullivan/net-sniff/internal/resolve"
+	"github.com/ezra-sullivan/net-sniff/internal/retry"
+	"github.com/ezra-sullivan/net-sniff/internal/service"
 	"time"
 
 	"github.com/ezra-sullivan/net-sniff/internal/pscan"
@@ -30,16 +34,49 @@ func NewCmdTCP(opts *options.Options) *cobra.Command {
 				}
 			}()
 
-			// 检查主机列表是否为空
-			if opts.Hosts == "" {
-				return fmt.Errorf("必须指定主机列表")
+			if opts.Targets != "" {
+				// 显式指定 host:port 目标时不使用主机列表和端口列表
+				if opts.Hosts != "" || opts.Ports != "" || opts.TopPorts > 0 || opts.ExcludePorts != "" {
+					return fmt.Errorf("--targets 不能与 --hosts、--ports、--top-ports 或 --exclude-ports 同时使用")
+				}
+			} else {
+				// 未指定主机列表、端口列表不从标准输入读取且标准输入来自管道时，从标准输入读取主机列表
+				if opts.Hosts == "" && opts.Ports != utils.Stdin && utils.StdinIsPipe() {
+					opts.Hosts = utils.Stdin
+				}
+
+				// 检查主机列表是否为空
+				if opts.Hosts == "" {
+					return fmt.Errorf("必须指定主机列表")
+				}
+
+				// 检查端口列表是否为空
+				if opts.Ports == "" && opts.TopPorts == 0 {
+					return fmt.Errorf("必须指定端口列表")
+				}
+
+				// 检查端口列表与标准输入的用法
+				if err := utils.CheckPortsStdin(opts.Hosts, opts.Ports); err != nil {
+					return err
+				}
+
+				// 端口列表和常用端口只能指定一个
+				if opts.Ports != "" && opts.TopPorts > 0 {
+					return fmt.Errorf("--top-ports 不能与 --ports 同时使用")
+				}
+			}
+
+			// 检查扫描模式
+			if err := pscan.CheckMode(opts.Mode); err != nil {
+				return err
 			}
 
-			// 检查端口列表是否为空
-			if opts.Ports == "" {
-				return fmt.Errorf("必须指定端口列表")
+			err := runTCP(cmd.Context(), opts)
+			// 被中断时不输出用法说明
+			if cmd.Context().Err() != nil {
+				cmd.SilenceUsage = true
 			}
-			return runTCP(opts)
+			return err
 		},
 	}
 
@@ -51,42 +88,175 @@ func NewCmdTCP(opts *options.Options) *cobra.Command {
 
 // addFlags 添加命令特定的标志
 func addFlags(cmd *cobra.Command, opts *options.Options) {
-	cmd.Flags().StringVarP(&opts.Hosts, "hosts", "H", "", "主机列表，逗号分隔或范围")
-	cmd.Flags().StringVarP(&opts.Ports, "ports", "p", "", "端口列表，逗号分隔或范围")
+	cmd.Flags().StringVarP(&opts.Hosts, "hosts", "H", "", "主机列表，逗号分隔、范围、文件路径或 - (标准输入)")
+	cmd.Flags().StringVarP(&opts.Ports, "ports", "p", "", "端口列表，逗号分隔的端口、范围、服务名或端口组 (web、db、mail、windows)，all 表示全部端口，- 表示从标准输入读取，!端口 表示排除，T:/U: 前缀指定协议")
+	cmd.Flags().IntVar(&opts.TopPorts, "top-ports", 0, fmt.Sprintf("扫描最常用的 N 个 TCP 端口 (1-%d)", utils.TopPortsLimit("tcp")))
+	cmd.Flags().StringVar(&opts.ExcludePorts, "exclude-ports", "", "排除的端口列表，格式与 --ports 相同")
+	cmd.Flags().StringVarP(&opts.Targets, "targets", "T", "", "host:port 目标列表，逗号分隔、文件路径或 - (标准输入)")
+	cmd.Flags().StringVar(&opts.Mode, "mode", pscan.ModeConnect, "扫描模式，connect (完整连接) 或 syn (半开放扫描，需要 Linux 和 root 权限，否则改用 connect)")
+	cmd.Flags().IntVar(&opts.Retries, "retries", 0, "连接超时（没有响应）时的重试次数，端口拒绝连接时不重试")
+	cmd.Flags().BoolVar(&opts.Banner, "banner", false, "读取开放端口的服务欢迎信息 (banner)，没有欢迎信息的端口最长等待 --banner-timeout")
+	cmd.Flags().StringVar(&opts.BannerProbe, "banner-probe", "", "服务端未主动发送欢迎信息时发送的探测数据，支持 \\r\\n 等转义，如 \"HEAD / HTTP/1.0\\r\\n\\r\\n\"（隐含 --banner）")
+	cmd.Flags().IntVar(&opts.BannerTimeout, "banner-timeout", 0, "读取欢迎信息的超时时间（毫秒），默认与 --timeout 相同")
+	cmd.Flags().BoolVar(&opts.ServiceDetect, "service-detect", false, "识别开放端口的服务和版本，每个探测各自建立连接并最长等待 --timeout，已有欢迎信息时跳过不适用的探测")
+	cmd.Flags().StringVar(&opts.ServiceProbes, "service-probes", "", "追加的服务探测库文件，格式与内置探测库相同（隐含 --service-detect）")
+	cmd.Flags().BoolVar(&opts.TLS, "tls", false, "检查开放端口的 TLS 证书和协议，21、25、110、143、587 端口或识别出 SMTP/IMAP/POP3/FTP 服务时使用 STARTTLS，服务端主动发送欢迎信息或识别出其他明文服务时跳过")
+	cmd.Flags().IntVar(&opts.TLSWarnDays, "tls-warn-days", 30, "证书剩余有效天数少于该值时输出警告")
+	cmd.Flags().BoolVar(&opts.HTTPProbe, "http-probe", false, "向开放端口发送 HTTP/HTTPS 请求，记录状态码、标题、Server、响应体长度和最终 URL，服务端主动发送欢迎信息或识别出非 HTTP 服务时跳过")
+	cmd.Flags().IntVar(&opts.HTTPRedirects, "http-max-redirects", 5, "HTTP 探测最多跟随的重定向次数")
+	cmd.Flags().IntVar(&opts.HTTPTimeout, "http-timeout", 0, "HTTP 请求（包括重定向）的超时时间（毫秒），默认与 --timeout 相同")
 }
 
 // runTCP 执行 TCP 扫描命令
-func runTCP(opts *options.Options) error {
+func runTCP(ctx context.Context, opts *options.Options) error {
 	consoleLogger := global.ConsoleLogger
-	// 解析主机列表
-	hostList, err := utils.ParseHostList(opts.Hosts)
+
+	// SYN 扫描器在全部结果读完后关闭
+	syn := pscan.NewScannerForMode(opts.Mode)
+	if syn != nil {
+		defer func() {
+			_ = syn.Close()
+		}()
+	}
+
+	// 结果文件第一行为列名
+	logger.OutputFileHeader(pscan.TCPColumns)
+
+	results, total, err := startTCP(ctx, opts, syn)
 	if err != nil {
-		consoleLogger.Error("解析主机列表错误", "error", err)
 		return err
 	}
 
-	// 解析端口范围
-	portList, err := utils.ParsePortRange(opts.Ports)
+	// 执行 TCP 端口扫描，结果到达即统计，不保留全部结果
+	completed, openCount, filteredCount := 0, 0, 0
+	for result := range results {
+		completed++
+		switch result.State {
+		case pscan.TCP_PORT_OPEN:
+			openCount++
+		case pscan.TCP_PORT_FILTERED:
+			filteredCount++
+		}
+	}
+
+	// 输出总结信息，分别统计开放、关闭和被过滤的端口
+	logger.OutputPortSummary("TCP 扫描", openCount, completed-openCount-filteredCount, filteredCount)
+
+	// 被中断时提示仅统计了已完成的部分
+	if runErr := ctx.Err(); runErr != nil {
+		consoleLogger.Warn("TCP 扫描已中断，仅统计已完成的部分", "completed", completed, "total", total)
+		return fmt.Errorf("TCP 扫描已中断: %w", runErr)
+	}
+
+	return nil
+}
+
+// startTCP 解析目标并启动 TCP 端口扫描，返回结果通道和扫描总数
+// 指定 --targets 时只扫描显式的 host:port 目标，否则扫描主机列表与端口列表的组合；syn 不为 nil 时执行 SYN 扫描
+func startTCP(ctx context.Context, opts *options.Options, syn *pscan.SYNScanner) (<-chan pscan.TCPScanResult, int, error) {
+	consoleLogger := global.ConsoleLogger
+	timeout := time.Duration(opts.Timeout) * time.Millisecond
+
+	// 创建域名解析器，每个主机名只解析一次
+	resolver, err := resolve.New(opts.Resolver, opts.AllAddrs, opts.ResolveNames)
 	if err != nil {
-		consoleLogger.Error("解析端口范围错误", "error", err)
-		return err
+		consoleLogger.Error("创建域名解析器错误", "error", err)
+		return nil, 0, err
 	}
 
-	logger.OutputStart("TCP 扫描", len(hostList), len(portList))
+	// 端口开放后读取欢迎信息，指定探测数据时隐含 --banner
+	var banner *pscan.BannerConfig
+	if opts.Banner || opts.BannerProbe != "" {
+		probe, err := utils.ParseProbe(opts.BannerProbe)
+		if err != nil {
+			consoleLogger.Error("解析探测数据错误", "error", err)
+			return nil, 0, err
+		}
 
-	// 执行 TCP 端口扫描
-	results := pscan.BatchScanTCPPorts(hostList, portList, opts.Concurrency, time.Duration(opts.Timeout)*time.Millisecond)
+		banner = &pscan.BannerConfig{Probe: probe, Timeout: timeout}
+		if opts.BannerTimeout > 0 {
+			banner.Timeout = time.Duration(opts.BannerTimeout) * time.Millisecond
+		}
+	}
 
-	// 统计结果
-	openCount := 0
-	for _, result := range results {
-		if result.IsOpen {
-			openCount++
+	// 端口开放后识别服务和版本
+	var services *pscan.ServiceConfig
+	if opts.ServiceDetect || opts.ServiceProbes != "" {
+		db, err := service.New(opts.ServiceProbes)
+		if err != nil {
+			consoleLogger.Error("加载服务探测库错误", "error", err)
+			return nil, 0, err
 		}
+		services = &pscan.ServiceConfig{Database: db, Timeout: timeout}
 	}
 
-	// 输出总结信息
-	logger.OutputSummary("TCP 扫描", openCount, len(results))
+	// 端口开放后检查 TLS 证书和协议
+	var tlsConfig *pscan.TLSConfig
+	if opts.TLS {
+		tlsConfig = &pscan.TLSConfig{Timeout: timeout, WarnDays: opts.TLSWarnDays}
+	}
 
-	return nil
+	// 端口开放后发送 HTTP/HTTPS 请求
+	var httpConfig *pscan.HTTPConfig
+	if opts.HTTPProbe {
+		httpConfig = &pscan.HTTPConfig{Timeout: timeout, MaxRedirects: opts.HTTPRedirects}
+		if opts.HTTPTimeout > 0 {
+			httpConfig.Timeout = time.Duration(opts.HTTPTimeout) * time.Millisecond
+		}
+	}
+
+	// 连接超时时按重试策略重试
+	retries := retry.NewPolicy(opts.Retries, time.Duration(opts.RetryBackoff)*time.Millisecond)
+
+	// 没有启用任何附加探测时不执行
+	var probes *pscan.TCPProbes
+	if banner != nil || services != nil || tlsConfig != nil || httpConfig != nil {
+		probes = &pscan.TCPProbes{Banner: banner, Service: services, TLS: tlsConfig, HTTP: httpConfig}
+	}
+
+	// 解析需要排除的主机
+	excluded, err := utils.ParseExcludes(opts.Exclude, opts.ExcludeFile)
+	if err != nil {
+		consoleLogger.Error("解析排除列表错误", "error", err)
+		return nil, 0, err
+	}
+
+	if opts.Targets != "" {
+		// 解析 host:port 目标列表
+		endpoints, err := utils.ParseEndpoints(opts.Targets)
+		if err != nil {
+			consoleLogger.Error("解析目标列表错误", "error", err)
+			return nil, 0, err
+		}
+
+		endpoints.Exclude(excluded)
+		if endpoints.Len() == 0 {
+			return nil, 0, fmt.Errorf("排除后没有剩余的目标")
+		}
+
+		logger.OutputStartEndpoints("TCP 扫描", endpoints.Len())
+		return pscan.StreamScanTCPEndpoints(ctx, resolver, endpoints.All(), opts.Concurrency, timeout, retries, syn, probes), endpoints.Len(), nil
+	}
+
+	// 解析主机列表
+	targets, err := utils.ParseTargets(opts.Hosts)
+	if err != nil {
+		consoleLogger.Error("解析主机列表错误", "error", err)
+		return nil, 0, err
+	}
+
+	targets.Exclude(excluded)
+	if targets.Len() == 0 {
+		return nil, 0, fmt.Errorf("排除后没有剩余的主机")
+	}
+
+	// 解析 TCP 端口，指定 --top-ports 时使用最常用的端口，并去掉 --exclude-ports 中的端口
+	portList, err := utils.SelectPorts("tcp", opts.Ports, opts.TopPorts, opts.ExcludePorts)
+	if err != nil {
+		consoleLogger.Error("解析端口范围错误", "error", err)
+		return nil, 0, err
+	}
+
+	logger.OutputStart("TCP 扫描", targets.Len(), len(portList))
+	return pscan.StreamScanTCPPorts(ctx, resolver, targets.All(), portList, opts.Concurrency, timeout, retries, syn, probes), targets.Len() * len(portList), nil
 }
@@ -1,10 +1,14 @@
 package udp
 
 import (
+	"context"
 	"fmt"
 	"github.com/ezra-sullivan/net-sniff/internal/global"
 	"github.com/ezra-sullivan/net-sniff/internal/initialize/logger"
 	"github.com/ezra-sullivan/net-sniff/internal/initialize/options"
+	"github.com/ezra-sullivan/net-sniff/internal/resolve"
+	"github.com/ezra-sullivan/net-sniff/internal/retry"
+	"github.com/ezra-sullivan/net-sniff/internal/service"
 	"time"
 
 	"github.com/ezra-sullivan/net-sniff/internal/pscan"
@@ -29,17 +33,49 @@ func NewCmdUDP(opts *options.Options) *cobra.Command {
 				}
 			}()
 
-			// 检查主机列表是否为空
-			if opts.Hosts == "" {
-				return fmt.Errorf("必须指定主机列表")
+			if opts.Targets != "" {
+				// 显式指定 host:port 目标时不使用主机列表和端口列表
+				if opts.Hosts != "" || opts.Ports != "" || opts.TopPorts > 0 || opts.ExcludePorts != "" {
+					return fmt.Errorf("--targets 不能与 --hosts、--ports、--top-ports 或 --exclude-ports 同时使用")
+				}
+			} else {
+				// 未指定主机列表、端口列表不从标准输入读取且标准输入来自管道时，从标准输入读取主机列表
+				if opts.Hosts == "" && opts.Ports != utils.Stdin && utils.StdinIsPipe() {
+					opts.Hosts = utils.Stdin
+				}
+
+				// 检查主机列表是否为空
+				if opts.Hosts == "" {
+					return fmt.Errorf("必须指定主机列表")
+				}
+
+				// 检查端口列表是否为空
+				if opts.Ports == "" && opts.TopPorts == 0 {
+					return fmt.Errorf("必须指定端口列表")
+				}
+
+				// 检查端口列表与标准输入的用法
+				if err := utils.CheckPortsStdin(opts.Hosts, opts.Ports); err != nil {
+					return err
+				}
+
+				// 端口列表和常用端口只能指定一个
+				if opts.Ports != "" && opts.TopPorts > 0 {
+					return fmt.Errorf("--top-ports 不能与 --ports 同时使用")
+				}
 			}
 
-			// 检查端口列表是否为空
-			if opts.Ports == "" {
-				return fmt.Errorf("必须指定端口列表")
+			// 单一载荷和自定义载荷库只能指定一个
+			if opts.UDPPayload != "" && opts.UDPPayloads != "" {
+				return fmt.Errorf("--udp-payload 不能与 --udp-payloads 同时使用")
 			}
 
-			return runUDP(opts)
+			err := runUDP(cmd.Context(), opts)
+			// 被中断时不输出用法说明
+			if cmd.Context().Err() != nil {
+				cmd.SilenceUsage = true
+			}
+			return err
 		},
 	}
 
@@ -51,42 +87,150 @@ func NewCmdUDP(opts *options.Options) *cobra.Command {
 
 // addFlags 添加命令特定的标志
 func addFlags(cmd *cobra.Command, opts *options.Options) {
-	cmd.Flags().StringVarP(&opts.Hosts, "hosts", "H", "", "主机列表，逗号分隔或范围")
-	cmd.Flags().StringVarP(&opts.Ports, "ports", "p", "", "端口列表，逗号分隔或范围")
+	cmd.Flags().StringVarP(&opts.Hosts, "hosts", "H", "", "主机列表，逗号分隔、范围、文件路径或 - (标准输入)")
+	cmd.Flags().StringVarP(&opts.Ports, "ports", "p", "", "端口列表，逗号分隔的端口、范围、服务名或端口组 (web、db、mail、windows)，all 表示全部端口，- 表示从标准输入读取，!端口 表示排除，T:/U: 前缀指定协议")
+	cmd.Flags().IntVar(&opts.TopPorts, "top-ports", 0, fmt.Sprintf("扫描最常用的 N 个 UDP 端口 (1-%d)", utils.TopPortsLimit("udp")))
+	cmd.Flags().StringVar(&opts.ExcludePorts, "exclude-ports", "", "排除的端口列表，格式与 --ports 相同")
+	cmd.Flags().IntVar(&opts.UDPRetries, "retries", 0, "端口没有响应时重新发送载荷的次数")
+	cmd.Flags().StringVar(&opts.UDPPayload, "udp-payload", "", "对所有 UDP 端口发送的载荷，支持 \\r\\n、\\xNN 等转义，替代内置载荷库")
+	cmd.Flags().StringVar(&opts.UDPPayloads, "udp-payloads", "", "追加的 UDP 载荷库文件，格式与内置载荷库相同，优先于内置载荷")
+	cmd.Flags().BoolVar(&opts.ServiceDetect, "service-detect", false, "识别开放端口的服务和版本")
+	cmd.Flags().StringVar(&opts.ServiceProbes, "service-probes", "", "追加的服务探测库文件，格式与内置探测库相同（隐含 --service-detect）")
+	cmd.Flags().StringVarP(&opts.Targets, "targets", "T", "", "host:port 目标列表，逗号分隔、文件路径或 - (标准输入)")
 }
 
 // runUDP 执行 UDP 扫描命令
-func runUDP(opts *options.Options) error {
+func runUDP(ctx context.Context, opts *options.Options) error {
 	consoleLogger := global.ConsoleLogger
-	// 解析主机列表
-	hostList, err := utils.ParseHostList(opts.Hosts)
+
+	// 有权限时监听 ICMP 不可达消息，更准确地判断关闭和被过滤的端口
+	icmp := pscan.ListenICMPIfPrivileged()
+	if icmp != nil {
+		defer func() {
+			_ = icmp.Close()
+		}()
+	}
+
+	// 结果文件第一行为列名
+	logger.OutputFileHeader(pscan.UDPColumns)
+
+	results, total, err := startUDP(ctx, opts, icmp)
 	if err != nil {
-		consoleLogger.Error("解析主机列表错误", "error", err)
 		return err
 	}
 
-	// 解析端口范围
-	portList, err := utils.ParsePortRange(opts.Ports)
+	// 执行 UDP 端口扫描，结果到达即统计，不保留全部结果
+	completed, openCount, closedCount, filteredCount := 0, 0, 0, 0
+	for result := range results {
+		completed++
+		switch result.IsOpen {
+		case pscan.UDP_PORT_OPEN:
+			openCount++
+		case pscan.UDP_PORT_CLOSED:
+			closedCount++
+		case pscan.UDP_PORT_FILTERED:
+			filteredCount++
+		}
+	}
+
+	// 输出总结信息，分别统计开放、没有响应、关闭和被过滤的端口
+	logger.OutputUDPPortSummary("UDP 扫描", openCount, completed-openCount-closedCount-filteredCount, closedCount, filteredCount)
+
+	// 被中断时提示仅统计了已完成的部分
+	if runErr := ctx.Err(); runErr != nil {
+		consoleLogger.Warn("UDP 扫描已中断，仅统计已完成的部分", "completed", completed, "total", total)
+		return fmt.Errorf("UDP 扫描已中断: %w", runErr)
+	}
+
+	return nil
+}
+
+// startUDP 解析目标并启动 UDP 端口扫描，返回结果通道和扫描总数
+// 指定 --targets 时只扫描显式的 host:port 目标，否则扫描主机列表与端口列表的组合
+func startUDP(ctx context.Context, opts *options.Options, icmp *pscan.ICMPListener) (<-chan pscan.UDPScanResult, int, error) {
+	consoleLogger := global.ConsoleLogger
+	timeout := time.Duration(opts.Timeout) * time.Millisecond
+
+	// 创建域名解析器，每个主机名只解析一次
+	resolver, err := resolve.New(opts.Resolver, opts.AllAddrs, opts.ResolveNames)
 	if err != nil {
-		consoleLogger.Error("解析端口范围错误", "error", err)
-		return err
+		consoleLogger.Error("创建域名解析器错误", "error", err)
+		return nil, 0, err
+	}
+
+	// 端口开放后识别服务和版本
+	var services *pscan.ServiceConfig
+	if opts.ServiceDetect || opts.ServiceProbes != "" {
+		db, err := service.New(opts.ServiceProbes)
+		if err != nil {
+			consoleLogger.Error("加载服务探测库错误", "error", err)
+			return nil, 0, err
+		}
+		services = &pscan.ServiceConfig{Database: db, Timeout: timeout}
+	}
+
+	// UDP 载荷：--udp-payload 对所有端口使用同一载荷，--udp-payloads 追加自定义载荷库，否则使用内置载荷库
+	var payloads *service.Payloads
+	if opts.UDPPayload != "" {
+		data, err := utils.ParseProbe(opts.UDPPayload)
+		if err != nil {
+			consoleLogger.Error("解析 UDP 载荷错误", "error", err)
+			return nil, 0, err
+		}
+		payloads = service.FixedPayload(data)
+	} else if opts.UDPPayloads != "" {
+		if payloads, err = service.NewPayloads(opts.UDPPayloads); err != nil {
+			consoleLogger.Error("加载 UDP 载荷库错误", "error", err)
+			return nil, 0, err
+		}
 	}
 
-	logger.OutputStart("UDP 扫描", len(hostList), len(portList))
+	// 端口没有响应时按重试策略重新发送载荷
+	retries := retry.NewPolicy(opts.UDPRetries, time.Duration(opts.RetryBackoff)*time.Millisecond)
 
-	// 执行 UDP 端口扫描
-	results := pscan.BatchScanUDPPorts(hostList, portList, opts.Concurrency, time.Duration(opts.Timeout)*time.Millisecond)
+	// 解析需要排除的主机
+	excluded, err := utils.ParseExcludes(opts.Exclude, opts.ExcludeFile)
+	if err != nil {
+		consoleLogger.Error("解析排除列表错误", "error", err)
+		return nil, 0, err
+	}
 
-	// 统计结果
-	openCount := 0
-	for _, result := range results {
-		if result.IsOpen == pscan.UDP_PORT_OPEN {
-			openCount++
+	if opts.Targets != "" {
+		// 解析 host:port 目标列表
+		endpoints, err := utils.ParseEndpoints(opts.Targets)
+		if err != nil {
+			consoleLogger.Error("解析目标列表错误", "error", err)
+			return nil, 0, err
 		}
+
+		endpoints.Exclude(excluded)
+		if endpoints.Len() == 0 {
+			return nil, 0, fmt.Errorf("排除后没有剩余的目标")
+		}
+
+		logger.OutputStartEndpoints("UDP 扫描", endpoints.Len())
+		return pscan.StreamScanUDPEndpoints(ctx, resolver, endpoints.All(), opts.Concurrency, timeout, retries, icmp, payloads, services), endpoints.Len(), nil
 	}
 
-	// 输出总结信息
-	logger.OutputSummary("UDP 扫描", openCount, len(results))
+	// 解析主机列表
+	targets, err := utils.ParseTargets(opts.Hosts)
+	if err != nil {
+		consoleLogger.Error("解析主机列表错误", "error", err)
+		return nil, 0, err
+	}
 
-	return nil
+	targets.Exclude(excluded)
+	if targets.Len() == 0 {
+		return nil, 0, fmt.Errorf("排除后没有剩余的主机")
+	}
+
+	// 解析 UDP 端口，指定 --top-ports 时使用最常用的端口，并去掉 --exclude-ports 中的端口
+	portList, err := utils.SelectPorts("udp", opts.Ports, opts.TopPorts, opts.ExcludePorts)
+	if err != nil {
+		consoleLogger.Error("解析端口范围错误", "error", err)
+		return nil, 0, err
+	}
+
+	logger.OutputStart("UDP 扫描", targets.Len(), len(portList))
+	return pscan.StreamScanUDPPorts(ctx, resolver, targets.All(), portList, opts.Concurrency, timeout, retries, icmp, payloads, services), targets.Len() * len(portList), nil
 }
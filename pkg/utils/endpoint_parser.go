@@ -0,0 +1,138 @@
+package utils
+
+import (
+	"fmt"
+	"iter"
+	"net"
+	"os"
+	"strings"
+)
+
+// Endpoints 显式指定的 host:port 目标列表
+// 端口范围只记录起止端口，遍历时才逐个生成，不会展开主机与端口的组合
+type Endpoints struct {
+	items []endpointItem
+	count int
+}
+
+// endpointItem 单个 host:port 条目，端口为连续范围（包含起止端口）
+type endpointItem struct {
+	host      string
+	firstPort int
+	lastPort  int
+}
+
+// ParseEndpoints 解析 host:port 目标列表，支持逗号分隔、文件路径和 - (标准输入)
+// 端口可以是单个端口或范围 (如 web1:8000-8100)，IPv6 地址需要使用方括号 (如 [::1]:8080)
+func ParseEndpoints(targets string) (*Endpoints, error) {
+	entries, err := splitEndpoints(targets)
+	if err != nil {
+		return nil, err
+	}
+
+	endpoints := &Endpoints{}
+	for _, entry := range entries {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+
+		if err := endpoints.parseEntry(entry); err != nil {
+			return nil, err
+		}
+	}
+
+	if endpoints.Len() == 0 {
+		return nil, fmt.Errorf("未指定有效的目标")
+	}
+
+	return endpoints, nil
+}
+
+// splitEndpoints 将目标列表拆分为条目，"-" 从标准输入读取，文件路径从文件读取，否则按逗号分隔
+func splitEndpoints(targets string) ([]string, error) {
+	// 从标准输入读取，每行一个目标
+	if targets == Stdin {
+		return readLines(os.Stdin)
+	}
+
+	// 如果是文件路径，从文件读取
+	if _, err := os.Stat(targets); err == nil {
+		file, err := os.Open(targets)
+		if err != nil {
+			return nil, err
+		}
+		defer func() {
+			_ = file.Close()
+		}()
+
+		return readLines(file)
+	}
+
+	// 否则按逗号分隔处理
+	return strings.Split(targets, ","), nil
+}
+
+// parseEntry 解析单个 host:port 条目并加入目标列表
+func (e *Endpoints) parseEntry(entry string) error {
+	host, portStr, err := net.SplitHostPort(entry)
+	if err != nil || host == "" || portStr == "" {
+		return fmt.Errorf("无效的目标格式: %s，应为 host:port 或 [IPv6]:port", entry)
+	}
+
+	// 主机必须是单个 IP 地址或主机名
+	if !isIPLiteral(host) {
+		if isInvalidIPFormat(host) {
+			return fmt.Errorf("无效的 IP 地址格式: %s", host)
+		}
+		if !isValidHostname(host) {
+			return fmt.Errorf("无效的 IP 地址或主机名: %s", host)
+		}
+	}
+
+	firstPort, lastPort, err := parsePortSpan(portStr)
+	if err != nil {
+		return fmt.Errorf("目标 %s: %w", entry, err)
+	}
+
+	e.items = append(e.items, endpointItem{host: host, firstPort: firstPort, lastPort: lastPort})
+	e.count += lastPort - firstPort + 1
+	return nil
+}
+
+// Len 返回目标总数，不会展开端口范围
+func (e *Endpoints) Len() int {
+	return e.count
+}
+
+// All 返回按需生成 host 和 port 的迭代器，可以多次遍历
+func (e *Endpoints) All() iter.Seq2[string, int] {
+	return func(yield func(string, int) bool) {
+		for _, item := range e.items {
+			for port := item.firstPort; port <= item.lastPort; port++ {
+				if !yield(item.host, port) {
+					return
+				}
+			}
+		}
+	}
+}
+
+// Exclude 排除主机在 excluded 中的目标，excluded 为 nil 时不做处理
+func (e *Endpoints) Exclude(excluded *Targets) {
+	if excluded == nil || len(excluded.items) == 0 {
+		return
+	}
+
+	names, ranges := excluded.exclusions()
+
+	items := e.items
+	e.items, e.count = nil, 0
+	for _, item := range items {
+		if isExcludedHost(item.host, names, ranges) {
+			continue
+		}
+		e.items = append(e.items, item)
+		e.count += item.lastPort - item.firstPort + 1
+	}
+}
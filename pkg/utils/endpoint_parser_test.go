@@ -0,0 +1,105 @@
+package utils
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// collectEndpoints 把目标列表展开为 host:port 字符串
+func collectEndpoints(e *Endpoints) []string {
+	var got []string
+	for host, port := range e.All() {
+		got = append(got, fmt.Sprintf("%s:%d", host, port))
+	}
+	return got
+}
+
+func TestParseEndpoints(t *testing.T) {
+	tests := []struct {
+		name    string
+		targets string
+		want    []string
+		wantErr bool
+	}{
+		{name: "单个目标", targets: "10.0.0.1:22", want: []string{"10.0.0.1:22"}},
+		{name: "逗号分隔", targets: "10.0.0.1:22, example.com:443,10.0.0.2:80", want: []string{"10.0.0.1:22", "example.com:443", "10.0.0.2:80"}},
+		{name: "端口范围", targets: "web1:8000-8002", want: []string{"web1:8000", "web1:8001", "web1:8002"}},
+		{name: "IPv6 地址", targets: "[::1]:8080,[2001:db8::1]:1-2", want: []string{"::1:8080", "2001:db8::1:1", "2001:db8::1:2"}},
+		{name: "保留重复目标", targets: "10.0.0.1:22,10.0.0.1:22", want: []string{"10.0.0.1:22", "10.0.0.1:22"}},
+		{name: "空条目被忽略", targets: "10.0.0.1:22,,", want: []string{"10.0.0.1:22"}},
+		{name: "缺少端口", targets: "10.0.0.1", wantErr: true},
+		{name: "缺少主机", targets: ":22", wantErr: true},
+		{name: "IPv6 缺少方括号", targets: "2001:db8::1:22", wantErr: true},
+		{name: "主机不能是网段", targets: "10.0.0.0/24:22", wantErr: true},
+		{name: "无效 IPv4 地址", targets: "10.0.0.256:22", wantErr: true},
+		{name: "无效主机名", targets: "bad_host!:22", wantErr: true},
+		{name: "端口超出范围", targets: "10.0.0.1:65536", wantErr: true},
+		{name: "端口范围颠倒", targets: "10.0.0.1:90-80", wantErr: true},
+		{name: "端口不是数字", targets: "10.0.0.1:ssh", wantErr: true},
+		{name: "空列表", targets: ",", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			endpoints, err := ParseEndpoints(tt.targets)
+			if tt.wantErr {
+				if err == nil {
+					t.Errorf("ParseEndpoints(%q) 应返回错误，得到 %v", tt.targets, collectEndpoints(endpoints))
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("ParseEndpoints(%q) 返回错误: %v", tt.targets, err)
+			}
+
+			got := collectEndpoints(endpoints)
+			if fmt.Sprint(got) != fmt.Sprint(tt.want) {
+				t.Errorf("ParseEndpoints(%q) = %v，期望 %v", tt.targets, got, tt.want)
+			}
+			if endpoints.Len() != len(tt.want) {
+				t.Errorf("ParseEndpoints(%q).Len() = %d，期望 %d", tt.targets, endpoints.Len(), len(tt.want))
+			}
+		})
+	}
+}
+
+func TestParseEndpointsFile(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "targets.txt")
+	content := "# 目标列表\n10.0.0.1:22\n\n[::1]:80-81\n"
+	if err := os.WriteFile(file, []byte(content), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	endpoints, err := ParseEndpoints(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{"10.0.0.1:22", "::1:80", "::1:81"}
+	if got := collectEndpoints(endpoints); fmt.Sprint(got) != fmt.Sprint(want) {
+		t.Errorf("从文件读取 = %v，期望 %v", got, want)
+	}
+}
+
+func TestEndpointsExclude(t *testing.T) {
+	endpoints, err := ParseEndpoints("10.0.0.1:22,10.0.0.2:80-81,example.com:443,[::ffff:10.0.0.3]:53")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// 排除范围内的 IPv4 地址和对应的映射地址，主机名不区分大小写
+	excluded, err := ParseExcludes("10.0.0.2-3,EXAMPLE.COM", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	endpoints.Exclude(excluded)
+
+	want := []string{"10.0.0.1:22"}
+	if got := collectEndpoints(endpoints); fmt.Sprint(got) != fmt.Sprint(want) {
+		t.Errorf("排除后 = %v，期望 %v", got, want)
+	}
+	if endpoints.Len() != 1 {
+		t.Errorf("排除后 Len() = %d，期望 1", endpoints.Len())
+	}
+}
@@ -2,76 +2,195 @@ package utils
 
 import (
 	"bufio"
-	"bytes"
 	"fmt"
-	"net"
+	"io"
+	"net/netip"
 	"os"
 	"regexp"
+	"slices"
 	"strconv"
 	"strings"
 )
 
+// Stdin 表示从标准输入读取主机列表或端口列表
+const Stdin = "-"
+
+// StdinIsPipe 检查标准输入是否来自管道或重定向，而不是终端
+func StdinIsPipe() bool {
+	info, err := os.Stdin.Stat()
+	if err != nil {
+		return false
+	}
+	return info.Mode()&os.ModeCharDevice == 0
+}
+
 // ParseHostList 解析主机列表，支持逗号分隔、文件路径和 CIDR 格式
+// 会展开全部地址，大网段请使用 ParseTargets
 func ParseHostList(hosts string) ([]string, error) {
+	targets, err := ParseTargets(hosts)
+	if err != nil {
+		return nil, err
+	}
+	return slices.Collect(targets.All()), nil
+}
+
+// ParseTargets 解析主机列表为惰性目标列表，支持逗号分隔、文件路径和 CIDR 格式
+func ParseTargets(hosts string) (*Targets, error) {
+	hostList, err := splitHosts(hosts)
+	if err != nil {
+		return nil, err
+	}
+
+	targets := &Targets{}
+	if err := addHostEntries(targets, hostList); err != nil {
+		return nil, err
+	}
+
+	if targets.Len() == 0 {
+		return nil, fmt.Errorf("未指定有效的主机")
+	}
+
+	return targets, nil
+}
+
+// ParseExcludes 解析需要排除的主机，exclude 的格式与 ParseTargets 相同，excludeFile 为主机列表文件
+// 两者都为空时返回 nil
+func ParseExcludes(exclude, excludeFile string) (*Targets, error) {
+	if exclude == "" && excludeFile == "" {
+		return nil, nil
+	}
+
+	excluded := &Targets{exclusion: true}
+
+	if exclude != "" {
+		hostList, err := splitHosts(exclude)
+		if err != nil {
+			return nil, err
+		}
+		if err := addHostEntries(excluded, hostList); err != nil {
+			return nil, err
+		}
+	}
+
+	if excludeFile != "" {
+		hostList, err := readHostsFromFile(excludeFile)
+		if err != nil {
+			return nil, fmt.Errorf("读取排除文件错误: %w", err)
+		}
+		if err := addHostEntries(excluded, hostList); err != nil {
+			return nil, fmt.Errorf("排除文件 %s: %w", excludeFile, err)
+		}
+	}
+
+	return excluded, nil
+}
+
+// splitHosts 将主机列表拆分为条目，"-" 从标准输入读取，文件路径从文件读取，否则按逗号分隔
+func splitHosts(hosts string) ([]string, error) {
+	// 从标准输入读取，每行一个主机
+	if hosts == Stdin {
+		return readHosts(os.Stdin, "标准输入")
+	}
+
 	// 如果是文件路径，从文件读取
 	if _, err := os.Stat(hosts); err == nil {
 		return readHostsFromFile(hosts)
 	}
 
-	// 否则按逗号分隔处理
-	hostList := strings.Split(hosts, ",")
-	result := make([]string, 0, len(hostList))
+	// 否则按逗号分隔处理，八位组列表中的逗号 (如 192.168.1,3,5.10) 不作为分隔符
+	return joinOctetLists(strings.Split(hosts, ",")), nil
+}
 
+// addHostEntries 逐个解析主机条目并加入目标列表，空条目会被忽略
+func addHostEntries(targets *Targets, hostList []string) error {
 	for _, host := range hostList {
 		host = strings.TrimSpace(host)
 		if host == "" {
 			continue
 		}
 
-		// 检查是否是 CIDR 格式
-		if isCIDR(host) {
-			ipList, err := expandCIDR(host)
-			if err != nil {
-				return nil, err
-			}
-			result = append(result, ipList...)
-			continue
+		if err := parseHostEntry(targets, host); err != nil {
+			return err
 		}
+	}
+	return nil
+}
 
-		// 检查是否是 IP 范围格式 (如 192.168.1.1-10)
-		if strings.Contains(host, "-") {
-			ipList, err := expandIPRange(host)
-			if err != nil {
-				return nil, err
-			}
-			result = append(result, ipList...)
-			continue
+// parseHostEntry 解析单个主机条目并加入目标列表
+func parseHostEntry(targets *Targets, host string) error {
+	// 去掉 IPv6 地址两侧的方括号 (如 [::1])
+	if strings.HasPrefix(host, "[") && strings.HasSuffix(host, "]") {
+		host = host[1 : len(host)-1]
+	}
+
+	// 检查是否是 CIDR 格式
+	if isCIDR(host) {
+		// 排除列表包含整个网段，且不展开地址，不受 IPv6 网段大小限制
+		if targets.exclusion {
+			prefix := netip.MustParsePrefix(host).Masked()
+			targets.addRange(prefix.Addr(), lastAddr(prefix))
+			return nil
+		}
+
+		first, last, err := cidrRange(host)
+		if err != nil {
+			return err
 		}
+		targets.addRange(first, last)
+		return nil
+	}
 
-		// 单个主机
-		if net.ParseIP(host) != nil || isValidHostname(host) {
-			// 直接添加有效的 IP 地址或主机名
-			result = append(result, host)
-		} else if isInvalidIPFormat(host) {
-			// 检查是否看起来像 IP 地址但格式不正确
-			return nil, fmt.Errorf("无效的 IP 地址格式: %s", host)
-		} else {
-			// 既不是有效的 IP 也不是有效的主机名
-			return nil, fmt.Errorf("无效的 IP 地址或主机名: %s", host)
+	// 检查是否是八位组模式 (如 10.1-3.0-255.1、192.168.1,3,5.10、10.0.*.1)
+	if isOctetPattern(host) {
+		pattern, err := parseOctetPattern(host)
+		if err != nil {
+			return err
 		}
+		targets.addPattern(pattern)
+		return nil
 	}
 
-	if len(result) == 0 {
-		return nil, fmt.Errorf("未指定有效的主机")
+	// 检查是否是 IP 范围格式 (如 192.168.1.1-10)
+	if isIPRange(host) {
+		first, last, err := ipRange(host)
+		if err != nil {
+			return err
+		}
+		targets.addRange(first, last)
+		return nil
 	}
 
-	return result, nil
+	// 单个主机
+	if isIPLiteral(host) {
+		// 直接添加有效的 IP 地址
+		targets.addHost(host)
+	} else if isInvalidIPFormat(host) {
+		// 检查是否看起来像 IP 地址但格式不正确
+		return fmt.Errorf("无效的 IP 地址格式: %s", host)
+	} else if isValidHostname(host) {
+		// 直接添加有效的主机名
+		targets.addHost(host)
+	} else {
+		// 既不是有效的 IP 也不是有效的主机名
+		return fmt.Errorf("无效的 IP 地址或主机名: %s", host)
+	}
+	return nil
 }
 
 // isInvalidIPFormat 检查字符串是否看起来像 IP 地址但格式不正确
 func isInvalidIPFormat(s string) bool {
-	// 检查是否包含点，看起来像 IP 地址
-	if strings.Count(s, ".") > 0 {
+	// 包含冒号，看起来像 IPv6 地址
+	if strings.Contains(s, ":") {
+		return !isIPLiteral(s)
+	}
+
+	// 包含通配符或列表的点分格式，但不是四段的八位组模式
+	if strings.Count(s, ".") > 0 && strings.ContainsAny(s, "*,") && octetListChars.MatchString(s) {
+		return true
+	}
+
+	// 只包含数字和点，看起来像 IPv4 地址
+	if strings.Count(s, ".") > 0 && ipRangeStart.MatchString(s) {
 		// 使用正则表达式检查是否为有效的 IPv4 地址格式
 		validIP := regexp.MustCompile(`^(25[0-5]|2[0-4][0-9]|[01]?[0-9][0-9]?)(\.(25[0-5]|2[0-4][0-9]|[01]?[0-9][0-9]?)){3}$`)
 		return !validIP.MatchString(s)
@@ -79,29 +198,50 @@ func isInvalidIPFormat(s string) bool {
 	return false
 }
 
+// isIPLiteral 检查字符串是否为 IPv4 或 IPv6 地址（支持 IPv6 区域标识，如 fe80::1%eth0）
+func isIPLiteral(s string) bool {
+	_, err := netip.ParseAddr(s)
+	return err == nil
+}
+
 // readHostsFromFile 从文件读取主机列表
 func readHostsFromFile(filePath string) ([]string, error) {
 	file, err := os.Open(filePath)
 	if err != nil {
 		return nil, err
 	}
-	defer func(file *os.File) {
-		err := file.Close()
-		if err != nil {
-			os.Exit(1)
+	defer func() {
+		_ = file.Close()
+	}()
+
+	return readHosts(file, "文件")
+}
+
+// readHosts 逐行读取主机列表，忽略空行和 # 开头的注释，source 用于错误信息
+func readHosts(r io.Reader, source string) ([]string, error) {
+	hosts, err := readLines(r)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, host := range hosts {
+		// 验证主机格式
+		if err := validateHost(host); err != nil {
+			return nil, fmt.Errorf("%s中包含无效的主机: %s, %w", source, host, err)
 		}
-	}(file)
+	}
+
+	return hosts, nil
+}
 
-	var hosts []string
-	scanner := bufio.NewScanner(file)
+// readLines 逐行读取内容，去掉首尾空白，忽略空行和 # 开头的注释
+func readLines(r io.Reader) ([]string, error) {
+	var lines []string
+	scanner := bufio.NewScanner(r)
 	for scanner.Scan() {
-		host := strings.TrimSpace(scanner.Text())
-		if host != "" && !strings.HasPrefix(host, "#") {
-			// 验证主机格式
-			if err := validateHost(host); err != nil {
-				return nil, fmt.Errorf("文件中包含无效的主机: %s, %w", host, err)
-			}
-			hosts = append(hosts, host)
+		line := strings.TrimSpace(scanner.Text())
+		if line != "" && !strings.HasPrefix(line, "#") {
+			lines = append(lines, line)
 		}
 	}
 
@@ -109,7 +249,7 @@ func readHostsFromFile(filePath string) ([]string, error) {
 		return nil, err
 	}
 
-	return hosts, nil
+	return lines, nil
 }
 
 // validateHost 验证主机是否为有效的 IP 地址或主机名
@@ -119,14 +259,13 @@ func validateHost(host string) error {
 		return nil
 	}
 
-	// 检查是否为 IP 范围
-	if strings.Contains(host, "-") {
+	// 检查是否为 IP 范围或八位组模式
+	if strings.Contains(host, "-") || isOctetPattern(host) {
 		return nil
 	}
 
-	// 检查是否为有效的 IPv4 地址
-	ip := net.ParseIP(host)
-	if ip == nil {
+	// 检查是否为有效的 IP 地址
+	if !isIPLiteral(strings.Trim(host, "[]")) {
 		// 检查是否看起来像 IP 地址但格式不正确
 		if isInvalidIPFormat(host) {
 			return fmt.Errorf("无效的 IP 地址格式: %s", host)
@@ -154,129 +293,146 @@ func isValidHostname(hostname string) bool {
 
 // isCIDR 检查字符串是否是 CIDR 格式
 func isCIDR(s string) bool {
-	_, _, err := net.ParseCIDR(s)
+	_, err := netip.ParsePrefix(s)
 	return err == nil
 }
 
-// expandCIDR 展开 CIDR 格式为 IP 列表
-func expandCIDR(cidr string) ([]string, error) {
-	ip, ipNet, err := net.ParseCIDR(cidr)
+// isIPRange 检查字符串是否是 IP 范围格式，带连字符的主机名不视为范围
+func isIPRange(s string) bool {
+	start, _, found := strings.Cut(s, "-")
+	return found && (ipRangeStart.MatchString(start) || ipv6RangeStart.MatchString(start))
+}
+
+var (
+	// ipRangeStart 匹配 IPv4 范围的起始部分（只包含数字和点）
+	ipRangeStart = regexp.MustCompile(`^[0-9.]+$`)
+
+	// ipv6RangeStart 匹配 IPv6 范围的起始部分（十六进制数字和冒号，至少包含一个冒号）
+	ipv6RangeStart = regexp.MustCompile(`^[0-9a-fA-F.]*:[0-9a-fA-F:.]*$`)
+)
+
+// cidrRange 计算 CIDR 网段的起止地址
+// 超过 2 个地址的 IPv4 网段不包含网络地址和广播地址；IPv6 网段受 maxIPv6RangeSize 限制
+func cidrRange(cidr string) (netip.Addr, netip.Addr, error) {
+	prefix, err := netip.ParsePrefix(cidr)
 	if err != nil {
-		return nil, err
+		return netip.Addr{}, netip.Addr{}, err
 	}
 
-	var ips []string
-	// 确保 IP 是 IPv4 格式
-	ip = ip.To4()
-	if ip == nil {
-		return nil, fmt.Errorf("只支持 IPv4 地址")
+	// IPv6 网段过大时拒绝展开
+	if prefix.Addr().Is6() && prefix.Addr().BitLen()-prefix.Bits() > maxIPv6RangeBits {
+		return netip.Addr{}, netip.Addr{}, fmt.Errorf("IPv6 网段过大: %s，前缀长度至少为 /%d", cidr, prefix.Addr().BitLen()-maxIPv6RangeBits)
 	}
 
-	// 复制 IP 以避免修改原始值
-	startIP := make(net.IP, len(ip))
-	copy(startIP, ip)
+	// 按掩码计算网段的第一个和最后一个地址
+	prefix = prefix.Masked()
+	first := prefix.Addr()
+	last := lastAddr(prefix)
 
-	// 计算网段中的 IP 数量
-	mask := ipNet.Mask
-	ones, bits := mask.Size()
-	size := 1 << uint(bits-ones)
-
-	// 生成所有 IP
-	for i := 0; i < size; i++ {
-		ips = append(ips, startIP.String())
-		incrementIP(startIP)
+	// 移除 IPv4 网络地址和广播地址（如果有超过2个地址）
+	if first.Is4() && prefix.Bits() < 31 {
+		first = first.Next()
+		last = last.Prev()
 	}
 
-	// 移除网络地址和广播地址（如果有超过2个地址）
-	if len(ips) > 2 {
-		return ips[1 : len(ips)-1], nil
-	}
-	return ips, nil
+	return first, last, nil
 }
 
-// incrementIP 增加 IP 地址
-func incrementIP(ip net.IP) {
-	for j := len(ip) - 1; j >= 0; j-- {
-		ip[j]++
-		if ip[j] > 0 {
-			break
-		}
+// lastAddr 计算网段中的最后一个地址
+func lastAddr(prefix netip.Prefix) netip.Addr {
+	b := prefix.Addr().AsSlice()
+	for i := prefix.Bits(); i < len(b)*8; i++ {
+		b[i/8] |= 1 << (7 - i%8)
 	}
+	addr, _ := netip.AddrFromSlice(b)
+	return addr
 }
 
-// expandIPRange 展开 IP 范围格式为 IP 列表
-func expandIPRange(ipRange string) ([]string, error) {
+// ipRange 解析 IP 范围格式的起止地址
+func ipRange(ipRange string) (netip.Addr, netip.Addr, error) {
 	parts := strings.Split(ipRange, "-")
 	if len(parts) != 2 {
-		return nil, fmt.Errorf("无效的 IP 范围格式: %s", ipRange)
+		return netip.Addr{}, netip.Addr{}, fmt.Errorf("无效的 IP 范围格式: %s", ipRange)
 	}
 
 	baseIP := parts[0]
 	endRange := parts[1]
 
-	// 检查是否是完整的 IP 地址范围 (如 192.168.1.1-192.168.1.10)
-	if strings.Count(endRange, ".") == 3 {
-		startIP := net.ParseIP(baseIP)
-		endIP := net.ParseIP(endRange)
-		if startIP == nil || endIP == nil {
-			return nil, fmt.Errorf("无效的 IP 地址范围: %s", ipRange)
+	// 检查是否是完整的 IP 地址范围 (如 192.168.1.1-192.168.1.10 或 2001:db8::1-2001:db8::ff)
+	if strings.Count(endRange, ".") == 3 || strings.Contains(endRange, ":") {
+		startIP, err1 := netip.ParseAddr(baseIP)
+		endIP, err2 := netip.ParseAddr(endRange)
+		if err1 != nil || err2 != nil {
+			return netip.Addr{}, netip.Addr{}, fmt.Errorf("无效的 IP 地址范围: %s", ipRange)
+		}
+
+		// 起止地址必须属于同一地址族
+		if startIP.Is4() != endIP.Is4() {
+			return netip.Addr{}, netip.Addr{}, fmt.Errorf("起止 IP 地址必须同为 IPv4 或 IPv6: %s", ipRange)
 		}
-		return expandFullIPRange(startIP, endIP)
+
+		// 比较 IP 地址
+		if startIP.Compare(endIP) > 0 {
+			return netip.Addr{}, netip.Addr{}, fmt.Errorf("结束 IP 地址必须大于或等于起始 IP 地址")
+		}
+
+		return startIP, endIP, checkRangeSize(ipRange, startIP, endIP)
 	}
 
-	// 处理简化的范围 (如 192.168.1.1-10)
-	ipParts := strings.Split(baseIP, ".")
-	if len(ipParts) != 4 {
-		return nil, fmt.Errorf("无效的 IP 地址格式: %s", baseIP)
+	// 处理简化的 IPv6 范围 (如 2001:db8::1-ff)，结束值为最后一段的十六进制值
+	if strings.Contains(baseIP, ":") {
+		startIP, err := netip.ParseAddr(baseIP)
+		if err != nil || !startIP.Is6() {
+			return netip.Addr{}, netip.Addr{}, fmt.Errorf("无效的 IP 地址格式: %s", baseIP)
+		}
+
+		endPart, err := strconv.ParseUint(endRange, 16, 16)
+		if err != nil {
+			return netip.Addr{}, netip.Addr{}, fmt.Errorf("无效的 IP 范围结束值: %s", endRange)
+		}
+
+		end := startIP.As16()
+		if uint64(end[14])<<8|uint64(end[15]) > endPart {
+			return netip.Addr{}, netip.Addr{}, fmt.Errorf("IP 范围结束值必须大于或等于起始值")
+		}
+		end[14], end[15] = byte(endPart>>8), byte(endPart)
+		endIP := netip.AddrFrom16(end).WithZone(startIP.Zone())
+
+		return startIP, endIP, checkRangeSize(ipRange, startIP, endIP)
 	}
 
-	// 获取基础 IP 的最后一部分
-	lastPart, err := strconv.Atoi(ipParts[3])
-	if err != nil {
-		return nil, fmt.Errorf("无效的 IP 地址格式: %s", baseIP)
+	// 处理简化的范围 (如 192.168.1.1-10)
+	startIP, err := netip.ParseAddr(baseIP)
+	if err != nil || !startIP.Is4() {
+		return netip.Addr{}, netip.Addr{}, fmt.Errorf("无效的 IP 地址格式: %s", baseIP)
 	}
 
 	// 获取范围的结束值
 	endPart, err := strconv.Atoi(endRange)
-	if err != nil {
-		return nil, fmt.Errorf("无效的 IP 范围结束值: %s", endRange)
-	}
-
-	if lastPart > endPart {
-		return nil, fmt.Errorf("IP 范围结束值必须大于或等于起始值")
+	if err != nil || endPart < 0 || endPart > 255 {
+		return netip.Addr{}, netip.Addr{}, fmt.Errorf("无效的 IP 范围结束值: %s", endRange)
 	}
 
-	var ips []string
-	basePrefix := strings.Join(ipParts[:3], ".") + "."
-	for i := lastPart; i <= endPart; i++ {
-		ips = append(ips, basePrefix+strconv.Itoa(i))
+	// 基础 IP 的最后一部分
+	start := startIP.As4()
+	if int(start[3]) > endPart {
+		return netip.Addr{}, netip.Addr{}, fmt.Errorf("IP 范围结束值必须大于或等于起始值")
 	}
 
-	return ips, nil
+	end := start
+	end[3] = byte(endPart)
+	return startIP, netip.AddrFrom4(end), nil
 }
 
-// expandFullIPRange 展开完整的 IP 地址范围
-func expandFullIPRange(startIP, endIP net.IP) ([]string, error) {
-	var ips []string
-	ip := make(net.IP, len(startIP))
-	copy(ip, startIP)
-
-	// 确保 IP 是 IPv4 格式
-	ip = ip.To4()
-	endIP = endIP.To4()
-	if ip == nil || endIP == nil {
-		return nil, fmt.Errorf("只支持 IPv4 地址范围")
-	}
-
-	// 比较 IP 地址
-	if bytes.Compare(ip, endIP) > 0 {
-		return nil, fmt.Errorf("结束 IP 地址必须大于或等于起始 IP 地址")
+// checkRangeSize 检查 IPv6 地址范围是否超过 maxIPv6RangeSize
+func checkRangeSize(ipRange string, first, last netip.Addr) error {
+	if first.Is4() {
+		return nil
 	}
 
-	for bytes.Compare(ip, endIP) <= 0 {
-		ips = append(ips, ip.String())
-		incrementIP(ip)
+	distance, ok := addrDistance(first, last)
+	if !ok || distance >= maxIPv6RangeSize {
+		return fmt.Errorf("IPv6 地址范围过大: %s，最多支持 %d 个地址", ipRange, maxIPv6RangeSize)
 	}
-
-	return ips, nil
+	return nil
 }
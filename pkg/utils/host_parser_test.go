@@ -0,0 +1,73 @@
+package utils
+
+import (
+	"slices"
+	"testing"
+)
+
+func TestParseTargets(t *testing.T) {
+	tests := []struct {
+		name    string
+		hosts   string
+		want    []string
+		wantLen int // 不为 0 时只检查数量，用于较大的范围
+		wantErr bool
+	}{
+		{name: "单个地址", hosts: "192.168.1.1", want: []string{"192.168.1.1"}},
+		{name: "逗号分隔", hosts: "10.0.0.1, example.com,10.0.0.2", want: []string{"10.0.0.1", "example.com", "10.0.0.2"}},
+		{name: "IPv4 网段去掉网络地址和广播地址", hosts: "10.0.0.0/30", want: []string{"10.0.0.1", "10.0.0.2"}},
+		{name: "IPv4 /31 网段", hosts: "10.0.0.0/31", want: []string{"10.0.0.0", "10.0.0.1"}},
+		{name: "IPv4 简化范围", hosts: "192.168.1.254-255", want: []string{"192.168.1.254", "192.168.1.255"}},
+		{name: "IPv4 完整范围", hosts: "10.0.0.255-10.0.1.1", want: []string{"10.0.0.255", "10.0.1.0", "10.0.1.1"}},
+		{name: "IPv6 地址", hosts: "[2001:db8::1]", want: []string{"2001:db8::1"}},
+		{name: "IPv6 网段", hosts: "2001:db8::/126", want: []string{"2001:db8::", "2001:db8::1", "2001:db8::2", "2001:db8::3"}},
+		{name: "IPv6 简化范围", hosts: "2001:db8::fe-101", want: []string{"2001:db8::fe", "2001:db8::ff", "2001:db8::100", "2001:db8::101"}},
+		{name: "IPv6 完整范围", hosts: "2001:db8::1-2001:db8::3", want: []string{"2001:db8::1", "2001:db8::2", "2001:db8::3"}},
+		{name: "IPv6 最大网段", hosts: "2001:db8::/112", wantLen: 1 << 16},
+		{name: "八位组列表", hosts: "192.168.1,3.10", want: []string{"192.168.1.10", "192.168.3.10"}},
+		{name: "八位组范围和列表", hosts: "10.1-2.0.1,3", want: []string{"10.1.0.1", "10.1.0.3", "10.2.0.1", "10.2.0.3"}},
+		{name: "八位组通配符", hosts: "10.0.*.1", wantLen: 256},
+		{name: "八位组模式后接其他主机", hosts: "10.0.0.1,3,10.0.0.9", want: []string{"10.0.0.1", "10.0.0.3", "10.0.0.9"}},
+		{name: "空条目被忽略", hosts: "10.0.0.1,,", want: []string{"10.0.0.1"}},
+		{name: "IPv6 网段过大", hosts: "2001:db8::/64", wantErr: true},
+		{name: "IPv6 范围过大", hosts: "2001:db8::1-2001:db8::1:1", wantErr: true},
+		{name: "IPv6 范围颠倒", hosts: "2001:db8::ff-1", wantErr: true},
+		{name: "混合地址族范围", hosts: "10.0.0.1-2001:db8::1", wantErr: true},
+		{name: "IPv4 范围颠倒", hosts: "10.0.0.10-1", wantErr: true},
+		{name: "IPv4 范围结束值过大", hosts: "10.0.0.1-256", wantErr: true},
+		{name: "八位组超出范围", hosts: "10.0.1-256.1", wantErr: true},
+		{name: "八位组范围颠倒", hosts: "10.0.5-1.1", wantErr: true},
+		{name: "无效 IPv4 地址", hosts: "10.0.0.256", wantErr: true},
+		{name: "无效主机名", hosts: "bad_host!", wantErr: true},
+		{name: "空列表", hosts: ",", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			targets, err := ParseTargets(tt.hosts)
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("ParseTargets(%q) 应返回错误，得到 %v", tt.hosts, slices.Collect(targets.All()))
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("ParseTargets(%q) 返回错误: %v", tt.hosts, err)
+			}
+
+			got := slices.Collect(targets.All())
+			if tt.wantLen != 0 {
+				if targets.Len() != tt.wantLen || len(got) != tt.wantLen {
+					t.Errorf("ParseTargets(%q) 数量 Len=%d, All=%d，期望 %d", tt.hosts, targets.Len(), len(got), tt.wantLen)
+				}
+				return
+			}
+			if !slices.Equal(got, tt.want) {
+				t.Errorf("ParseTargets(%q) = %v，期望 %v", tt.hosts, got, tt.want)
+			}
+			if targets.Len() != len(tt.want) {
+				t.Errorf("ParseTargets(%q).Len() = %d，期望 %d", tt.hosts, targets.Len(), len(tt.want))
+			}
+		})
+	}
+}
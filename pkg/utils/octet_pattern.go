@@ -0,0 +1,256 @@
+package utils
+
+import (
+	"fmt"
+	"iter"
+	"net/netip"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// octetPattern 按八位组描述的 IPv4 地址集合，如 10.1-3.0-255.1、192.168.1,3,5.10、10.0.*.1
+// 每个八位组的取值升序且不重复，因此生成的地址也是升序的
+type octetPattern [4][]byte
+
+var (
+	// octetPatternFormat 匹配四段八位组模式，每段由数字、范围、通配符和逗号组成
+	octetPatternFormat = regexp.MustCompile(`^[0-9*,\-]+(\.[0-9*,\-]+){3}$`)
+
+	// octetListChars 匹配八位组模式可能包含的字符，用于识别被逗号拆开的模式
+	octetListChars = regexp.MustCompile(`^[0-9*,\-.]+$`)
+)
+
+// isOctetPattern 检查字符串是否是八位组模式
+// 只有最后一段是范围的格式 (如 192.168.1.1-10) 仍由 ipRange 处理
+func isOctetPattern(s string) bool {
+	if !octetPatternFormat.MatchString(s) {
+		return false
+	}
+	return strings.ContainsAny(s, "*,") || strings.Contains(s[:strings.LastIndex(s, ".")], "-")
+}
+
+// joinOctetLists 重新拼接被逗号分隔拆开的八位组列表
+// 如 ["192.168.1", "3", "5.10"] 拼接为 ["192.168.1,3,5.10"]，["10.0.0.1", "3"] 拼接为 ["10.0.0.1,3"]
+func joinOctetLists(parts []string) []string {
+	var joined []string
+	for _, part := range parts {
+		part = strings.TrimSpace(part)
+		if n := len(joined); n > 0 && continuesOctetList(joined[n-1], part) {
+			joined[n-1] += "," + part
+			continue
+		}
+		joined = append(joined, part)
+	}
+	return joined
+}
+
+// continuesOctetList 检查 next 是否是 prev 中八位组列表的后续部分
+func continuesOctetList(prev, next string) bool {
+	if !octetListChars.MatchString(prev) || !octetListChars.MatchString(next) || strings.HasPrefix(next, ".") {
+		return false
+	}
+
+	prevDots, nextDots := strings.Count(prev, "."), strings.Count(next, ".")
+	if prevDots < 3 {
+		// 前一部分还不足四段
+		return prevDots+nextDots <= 3
+	}
+	// 前一部分已满四段，只有不含点的部分才属于最后一段的列表
+	return prevDots == 3 && nextDots == 0
+}
+
+// parseOctetPattern 解析八位组模式，每段可以是数字、范围 (N-M)、通配符 (*) 或逗号分隔的列表
+func parseOctetPattern(s string) (*octetPattern, error) {
+	parts := strings.Split(s, ".")
+	if len(parts) != 4 {
+		return nil, fmt.Errorf("无效的 IP 地址格式: %s", s)
+	}
+
+	var pattern octetPattern
+	for i, part := range parts {
+		var values [256]bool
+		for _, item := range strings.Split(part, ",") {
+			first, last, err := parseOctetItem(s, item)
+			if err != nil {
+				return nil, err
+			}
+			for v := first; v <= last; v++ {
+				values[v] = true
+			}
+		}
+
+		for v, ok := range values {
+			if ok {
+				pattern[i] = append(pattern[i], byte(v))
+			}
+		}
+	}
+	return &pattern, nil
+}
+
+// parseOctetItem 解析八位组中的单个取值、范围或通配符
+func parseOctetItem(pattern, item string) (int, int, error) {
+	if item == "*" {
+		return 0, 255, nil
+	}
+
+	startPart, endPart, isRange := strings.Cut(item, "-")
+	start, err := parseOctet(startPart)
+	if err != nil {
+		return 0, 0, fmt.Errorf("无效的 IP 地址格式: %s", pattern)
+	}
+	if !isRange {
+		return start, start, nil
+	}
+
+	end, err := parseOctet(endPart)
+	if err != nil {
+		return 0, 0, fmt.Errorf("无效的 IP 范围结束值: %s", endPart)
+	}
+	if start > end {
+		return 0, 0, fmt.Errorf("IP 范围结束值必须大于或等于起始值")
+	}
+	return start, end, nil
+}
+
+// parseOctet 解析 0-255 的八位组数值
+func parseOctet(s string) (int, error) {
+	if s == "" || strings.ContainsAny(s, "+-") {
+		return 0, fmt.Errorf("无效的八位组: %q", s)
+	}
+	v, err := strconv.Atoi(s)
+	if err != nil || v > 255 {
+		return 0, fmt.Errorf("无效的八位组: %q", s)
+	}
+	return v, nil
+}
+
+// size 返回模式包含的地址数量
+func (p *octetPattern) size() int {
+	return p.suffixSize(0)
+}
+
+// suffixSize 返回从第 i 段开始的各段取值数量的乘积
+func (p *octetPattern) suffixSize(i int) int {
+	n := 1
+	for ; i < len(p); i++ {
+		n *= len(p[i])
+	}
+	return n
+}
+
+// first 返回模式中的最小地址
+func (p *octetPattern) first() netip.Addr {
+	return netip.AddrFrom4([4]byte{p[0][0], p[1][0], p[2][0], p[3][0]})
+}
+
+// last 返回模式中的最大地址
+func (p *octetPattern) last() netip.Addr {
+	return netip.AddrFrom4([4]byte{p[0][len(p[0])-1], p[1][len(p[1])-1], p[2][len(p[2])-1], p[3][len(p[3])-1]})
+}
+
+// addrs 按升序生成模式中的全部地址
+func (p *octetPattern) addrs() iter.Seq[netip.Addr] {
+	return func(yield func(netip.Addr) bool) {
+		for _, a := range p[0] {
+			for _, b := range p[1] {
+				for _, c := range p[2] {
+					for _, d := range p[3] {
+						if !yield(netip.AddrFrom4([4]byte{a, b, c, d})) {
+							return
+						}
+					}
+				}
+			}
+		}
+	}
+}
+
+// countBelow 返回模式中小于 addr 的地址数量，addr 必须是 IPv4 地址
+func (p *octetPattern) countBelow(addr netip.Addr) int {
+	b := addr.As4()
+	n := 0
+	for i := range p {
+		idx, found := slices.BinarySearch(p[i], b[i])
+		n += idx * p.suffixSize(i+1)
+		if !found {
+			return n
+		}
+	}
+	return n
+}
+
+// contains 检查地址是否属于模式
+func (p *octetPattern) contains(addr netip.Addr) bool {
+	if !addr.Is4() {
+		return false
+	}
+	b := addr.As4()
+	for i := range p {
+		if _, found := slices.BinarySearch(p[i], b[i]); !found {
+			return false
+		}
+	}
+	return true
+}
+
+// countIn 返回模式中落在 ranges 内的地址数量，ranges 必须互不重叠
+func (p *octetPattern) countIn(ranges []targetItem) int {
+	n := 0
+	for _, r := range ranges {
+		if !r.first.Is4() || !r.last.Is4() {
+			continue
+		}
+		n += p.countBelow(r.last) - p.countBelow(r.first)
+		if p.contains(r.last) {
+			n++
+		}
+	}
+	return n
+}
+
+// ranges 将模式拆分为升序的连续地址范围，末尾取满 0-255 的段会合并到同一范围中
+func (p *octetPattern) ranges() []targetItem {
+	// 找到最后一个未取满的段，其后的段都会合并到范围中
+	k := 0
+	for i := len(p) - 1; i > 0; i-- {
+		if len(p[i]) != 256 {
+			k = i
+			break
+		}
+	}
+
+	var ranges []targetItem
+	var prefix [4]byte
+	var walk func(i int)
+	walk = func(i int) {
+		if i < k {
+			for _, v := range p[i] {
+				prefix[i] = v
+				walk(i + 1)
+			}
+			return
+		}
+
+		// 第 k 段中连续的取值合并为一个范围
+		values := p[k]
+		for start := 0; start < len(values); {
+			end := start
+			for end+1 < len(values) && values[end+1] == values[end]+1 {
+				end++
+			}
+
+			first, last := prefix, prefix
+			first[k], last[k] = values[start], values[end]
+			for j := k + 1; j < len(p); j++ {
+				first[j], last[j] = 0, 255
+			}
+			ranges = append(ranges, targetItem{first: netip.AddrFrom4(first), last: netip.AddrFrom4(last)})
+			start = end + 1
+		}
+	}
+	walk(0)
+	return ranges
+}
@@ -2,13 +2,63 @@ package utils
 
 import (
 	"fmt"
+	"os"
+	"slices"
 	"strconv"
 	"strings"
 )
 
-// ParsePortRange 解析端口范围
+// AllPorts 表示扫描全部端口 (1-65535)，不区分大小写，可以与协议前缀和排除一起使用 (如 T:all,!9100)
+const AllPorts = "all"
+
+// PortSpec 按协议区分的端口列表
+type PortSpec struct {
+	TCP []int
+	UDP []int
+}
+
+// protocol 端口列表中的协议序号
+const (
+	protoTCP = iota
+	protoUDP
+	protoCount
+)
+
+// ParsePortRange 解析端口范围，支持 ParsePortSpec 的全部语法
+// 带协议前缀时返回所有协议端口的并集（先 TCP 后 UDP）
 func ParsePortRange(ports string) ([]int, error) {
+	spec, err := ParsePortSpec(ports)
+	if err != nil {
+		return nil, err
+	}
+
 	var result []int
+	seen := make([]bool, 65536)
+	for _, port := range slices.Concat(spec.TCP, spec.UDP) {
+		if !seen[port] {
+			seen[port] = true
+			result = append(result, port)
+		}
+	}
+	return result, nil
+}
+
+// ParsePortSpec 解析按协议区分的端口列表
+// 支持逗号分隔的端口、范围、服务名 (如 ssh、https、mysql) 和端口组 (web、db、mail、windows)，"all" 表示全部端口
+// T: 和 U: 前缀指定后续端口的协议 (如 T:22,80,U:53,161)，没有前缀的端口同时属于 TCP 和 UDP
+// ! 前缀表示排除 (如 1-65535,!9100-9200)；重复的端口只保留第一次出现的位置；"-" 表示从标准输入读取，每行的格式相同
+func ParsePortSpec(ports string) (*PortSpec, error) {
+	// 从标准输入读取端口列表，各行按逗号拼接
+	if ports == Stdin {
+		lines, err := readLines(os.Stdin)
+		if err != nil {
+			return nil, fmt.Errorf("读取标准输入错误: %w", err)
+		}
+		ports = strings.Join(lines, ",")
+	}
+
+	var include, exclude [protoCount]portSet
+	protos := []int{protoTCP, protoUDP}
 
 	// 解析逗号分隔的端口列表
 	for _, portStr := range strings.Split(ports, ",") {
@@ -17,56 +67,277 @@ func ParsePortRange(ports string) ([]int, error) {
 			continue
 		}
 
-		// 检查是否为端口范围
-		if strings.Contains(portStr, "-") {
-			// 解析端口范围
-			rangeParts := strings.Split(portStr, "-")
-			if len(rangeParts) != 2 {
-				return nil, fmt.Errorf("无效的端口范围格式: %s", portStr)
+		// 协议前缀对之后的端口都生效
+		if proto, rest, ok := cutProtocol(portStr); ok {
+			protos = []int{proto}
+			if portStr = strings.TrimSpace(rest); portStr == "" {
+				continue
 			}
+		}
 
-			startPort, err := strconv.Atoi(strings.TrimSpace(rangeParts[0]))
-			if err != nil {
-				return nil, fmt.Errorf("无效的起始端口: %s", rangeParts[0])
+		// 排除的端口
+		target := &include
+		if rest, ok := strings.CutPrefix(portStr, "!"); ok {
+			target, portStr = &exclude, strings.TrimSpace(rest)
+			if portStr == "" {
+				return nil, fmt.Errorf("! 之后缺少端口")
 			}
+		}
 
-			endPort, err := strconv.Atoi(strings.TrimSpace(rangeParts[1]))
-			if err != nil {
-				return nil, fmt.Errorf("无效的结束端口: %s", rangeParts[1])
-			}
+		portList, err := expandPorts(portStr)
+		if err != nil {
+			return nil, err
+		}
+		for _, proto := range protos {
+			target[proto].add(portList...)
+		}
+	}
 
-			// 验证端口范围
-			if startPort < 1 || startPort > 65535 || endPort < 1 || endPort > 65535 {
-				return nil, fmt.Errorf("端口必须在 1-65535 范围内")
-			}
+	spec := &PortSpec{
+		TCP: include[protoTCP].without(&exclude[protoTCP]),
+		UDP: include[protoUDP].without(&exclude[protoUDP]),
+	}
+	if len(spec.TCP) == 0 && len(spec.UDP) == 0 {
+		return nil, fmt.Errorf("未指定有效的端口")
+	}
 
-			if endPort < startPort {
-				return nil, fmt.Errorf("结束端口必须大于或等于起始端口")
-			}
+	return spec, nil
+}
 
-			// 添加端口范围
-			for port := startPort; port <= endPort; port++ {
-				result = append(result, port)
-			}
-		} else {
-			// 解析单个端口
-			port, err := strconv.Atoi(portStr)
+// CheckPortsStdin 检查端口列表与标准输入的用法：标准输入只能读取一次，主机列表和端口列表不能同时从标准输入读取
+func CheckPortsStdin(hosts, ports string) error {
+	if hosts == Stdin && ports == Stdin {
+		return fmt.Errorf("主机列表和端口列表不能同时从标准输入读取")
+	}
+	return nil
+}
+
+// SelectPorts 选择指定协议 ("tcp" 或 "udp") 需要扫描的端口
+// top 大于 0 时使用最常用的 top 个端口，否则解析 ports；exclude 不为空时排除其中的端口
+// 只使用该协议的常用端口列表，top 超过列表长度时返回错误
+func SelectPorts(protocol, ports string, top int, exclude string) ([]int, error) {
+	spec := &PortSpec{}
+	if top > 0 {
+		portList, err := TopPorts(protocol, top)
+		if err != nil {
+			return nil, err
+		}
+		spec.TCP, spec.UDP = portList, portList
+	} else {
+		var err error
+		if spec, err = ParsePortSpec(ports); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := spec.exclude(exclude); err != nil {
+		return nil, err
+	}
+
+	portList := spec.ports(protocol)
+	if len(portList) == 0 {
+		return nil, fmt.Errorf("未指定有效的 %s 端口", strings.ToUpper(protocol))
+	}
+	return portList, nil
+}
+
+// SelectPortSpec 同时选择 TCP 和 UDP 需要扫描的端口，规则与 SelectPorts 相同
+// top 超过某种协议的常用端口列表长度时使用该协议的整个列表；只有一种协议没有端口时不返回错误
+func SelectPortSpec(ports string, top int, exclude string) (*PortSpec, error) {
+	spec := &PortSpec{}
+	if top > 0 {
+		for _, protocol := range []string{"tcp", "udp"} {
+			portList, err := topPortList(protocol)
 			if err != nil {
-				return nil, fmt.Errorf("无效的端口: %s", portStr)
+				return nil, err
 			}
+			spec.setPorts(protocol, portList[:min(top, len(portList))])
+		}
+	} else {
+		var err error
+		if spec, err = ParsePortSpec(ports); err != nil {
+			return nil, err
+		}
+	}
 
-			// 验证端口
-			if port < 1 || port > 65535 {
-				return nil, fmt.Errorf("端口必须在 1-65535 范围内")
-			}
+	if err := spec.exclude(exclude); err != nil {
+		return nil, err
+	}
+
+	if len(spec.TCP) == 0 && len(spec.UDP) == 0 {
+		return nil, fmt.Errorf("排除后没有剩余的端口")
+	}
+	return spec, nil
+}
+
+// exclude 去掉 exclude 中的端口，exclude 的格式与 ParsePortSpec 相同，为空时不排除
+func (s *PortSpec) exclude(exclude string) error {
+	if exclude == "" {
+		return nil
+	}
+
+	excluded, err := ParsePortSpec(exclude)
+	if err != nil {
+		return fmt.Errorf("解析排除端口错误: %w", err)
+	}
+	s.TCP = withoutPorts(s.TCP, excluded.TCP)
+	s.UDP = withoutPorts(s.UDP, excluded.UDP)
+	return nil
+}
+
+// withoutPorts 返回 ports 中不在 excluded 里的端口，不修改 ports
+func withoutPorts(ports, excluded []int) []int {
+	var skip portSet
+	skip.add(excluded...)
+	return slices.DeleteFunc(slices.Clone(ports), func(port int) bool {
+		return skip.seen[port]
+	})
+}
+
+// ports 返回指定协议的端口列表
+func (s *PortSpec) ports(protocol string) []int {
+	if protocol == "udp" {
+		return s.UDP
+	}
+	return s.TCP
+}
+
+// setPorts 设置指定协议的端口列表
+func (s *PortSpec) setPorts(protocol string, ports []int) {
+	if protocol == "udp" {
+		s.UDP = ports
+	} else {
+		s.TCP = ports
+	}
+}
+
+// cutProtocol 去掉 T: 或 U: 协议前缀（不区分大小写）
+func cutProtocol(s string) (int, string, bool) {
+	if len(s) < 2 || s[1] != ':' {
+		return 0, s, false
+	}
+	switch s[0] {
+	case 'T', 't':
+		return protoTCP, s[2:], true
+	case 'U', 'u':
+		return protoUDP, s[2:], true
+	}
+	return 0, s, false
+}
+
+// expandPorts 展开单个端口、范围、服务名或端口组
+func expandPorts(portStr string) ([]int, error) {
+	if portStr == "" {
+		return nil, fmt.Errorf("端口不能为空")
+	}
+
+	// 全部端口
+	if strings.EqualFold(portStr, AllPorts) {
+		portStr = "1-65535"
+	}
+
+	// 服务名或端口组
+	if isPortName(portStr) {
+		named, ok := namedPorts(portStr)
+		if !ok {
+			return nil, fmt.Errorf("未知的服务名或端口组: %s", portStr)
+		}
+		return named, nil
+	}
+
+	startPort, endPort, err := parsePortSpan(portStr)
+	if err != nil {
+		return nil, err
+	}
+
+	portList := make([]int, 0, endPort-startPort+1)
+	for port := startPort; port <= endPort; port++ {
+		portList = append(portList, port)
+	}
+	return portList, nil
+}
+
+// portSet 保持添加顺序且不重复的端口集合
+type portSet struct {
+	list []int
+	seen []bool
+}
 
+// add 添加端口，已存在的端口会被忽略
+func (s *portSet) add(ports ...int) {
+	if s.seen == nil {
+		s.seen = make([]bool, 65536)
+	}
+	for _, port := range ports {
+		if !s.seen[port] {
+			s.seen[port] = true
+			s.list = append(s.list, port)
+		}
+	}
+}
+
+// without 返回不在 excluded 中的端口
+func (s *portSet) without(excluded *portSet) []int {
+	if excluded.seen == nil {
+		return s.list
+	}
+	var result []int
+	for _, port := range s.list {
+		if !excluded.seen[port] {
 			result = append(result, port)
 		}
 	}
+	return result
+}
 
-	if len(result) == 0 {
-		return nil, fmt.Errorf("未指定有效的端口")
+// isPortName 检查是否为服务名或端口组名（以字母开头）
+func isPortName(s string) bool {
+	c := s[0]
+	return c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z'
+}
+
+// parsePortSpan 解析单个端口或端口范围，返回起止端口
+func parsePortSpan(portStr string) (int, int, error) {
+	// 检查是否为端口范围
+	if strings.Contains(portStr, "-") {
+		// 解析端口范围
+		rangeParts := strings.Split(portStr, "-")
+		if len(rangeParts) != 2 {
+			return 0, 0, fmt.Errorf("无效的端口范围格式: %s", portStr)
+		}
+
+		startPort, err := strconv.Atoi(strings.TrimSpace(rangeParts[0]))
+		if err != nil {
+			return 0, 0, fmt.Errorf("无效的起始端口: %s", rangeParts[0])
+		}
+
+		endPort, err := strconv.Atoi(strings.TrimSpace(rangeParts[1]))
+		if err != nil {
+			return 0, 0, fmt.Errorf("无效的结束端口: %s", rangeParts[1])
+		}
+
+		// 验证端口范围
+		if startPort < 1 || startPort > 65535 || endPort < 1 || endPort > 65535 {
+			return 0, 0, fmt.Errorf("端口必须在 1-65535 范围内")
+		}
+
+		if endPort < startPort {
+			return 0, 0, fmt.Errorf("结束端口必须大于或等于起始端口")
+		}
+
+		return startPort, endPort, nil
 	}
 
-	return result, nil
+	// 解析单个端口
+	port, err := strconv.Atoi(portStr)
+	if err != nil {
+		return 0, 0, fmt.Errorf("无效的端口: %s", portStr)
+	}
+
+	// 验证端口
+	if port < 1 || port > 65535 {
+		return 0, 0, fmt.Errorf("端口必须在 1-65535 范围内")
+	}
+
+	return port, port, nil
 }
@@ -0,0 +1,190 @@
+package utils
+
+import (
+	"slices"
+	"strconv"
+	"testing"
+)
+
+func TestParsePortSpec(t *testing.T) {
+	tests := []struct {
+		name    string
+		ports   string
+		tcp     []int
+		udp     []int
+		wantErr bool
+	}{
+		{name: "单个端口", ports: "80", tcp: []int{80}, udp: []int{80}},
+		{name: "范围和去重", ports: "22,20-23,22", tcp: []int{22, 20, 21, 23}, udp: []int{22, 20, 21, 23}},
+		{name: "服务名", ports: "ssh,HTTPS", tcp: []int{22, 443}, udp: []int{22, 443}},
+		{name: "端口组", ports: "mail", tcp: []int{25, 110, 143, 465, 587, 993, 995}, udp: []int{25, 110, 143, 465, 587, 993, 995}},
+		{name: "协议前缀", ports: "T:22,80,U:53,161", tcp: []int{22, 80}, udp: []int{53, 161}},
+		{name: "小写协议前缀", ports: "t:22,u:53", tcp: []int{22}, udp: []int{53}},
+		{name: "排除", ports: "20-25,!22-23", tcp: []int{20, 21, 24, 25}, udp: []int{20, 21, 24, 25}},
+		{name: "只排除 UDP", ports: "53,80,U:!53", tcp: []int{53, 80}, udp: []int{80}},
+		{name: "空元素被忽略", ports: "80,,443,", tcp: []int{80, 443}, udp: []int{80, 443}},
+		{name: "只有排除", ports: "!80", wantErr: true},
+		{name: "单独的 !", ports: "!", wantErr: true},
+		{name: "末尾单独的 !", ports: "80,!", wantErr: true},
+		{name: "协议前缀后单独的 !", ports: "T:!", wantErr: true},
+		{name: "协议前缀后带空格的 !", ports: "U:! ", wantErr: true},
+		{name: "! 后只有空格", ports: "80,! ", wantErr: true},
+		{name: "端口超出范围", ports: "65536", wantErr: true},
+		{name: "端口为 0", ports: "0", wantErr: true},
+		{name: "范围颠倒", ports: "100-10", wantErr: true},
+		{name: "无效范围", ports: "1-2-3", wantErr: true},
+		{name: "未知服务名", ports: "nosuchservice", wantErr: true},
+		{name: "空字符串", ports: "", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			spec, err := ParsePortSpec(tt.ports)
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("ParsePortSpec(%q) 应返回错误，得到 %+v", tt.ports, spec)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("ParsePortSpec(%q) 返回错误: %v", tt.ports, err)
+			}
+			if !slices.Equal(spec.TCP, tt.tcp) {
+				t.Errorf("ParsePortSpec(%q).TCP = %v，期望 %v", tt.ports, spec.TCP, tt.tcp)
+			}
+			if !slices.Equal(spec.UDP, tt.udp) {
+				t.Errorf("ParsePortSpec(%q).UDP = %v，期望 %v", tt.ports, spec.UDP, tt.udp)
+			}
+		})
+	}
+}
+
+func TestParsePortSpecAllPorts(t *testing.T) {
+	for _, ports := range []string{AllPorts, "ALL", "T:all,U:53"} {
+		spec, err := ParsePortSpec(ports)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(spec.TCP) != 65535 || spec.TCP[0] != 1 || spec.TCP[65534] != 65535 {
+			t.Errorf("ParsePortSpec(%q).TCP 应为 1-65535，得到 %d 个端口", ports, len(spec.TCP))
+		}
+	}
+
+	spec, err := ParsePortSpec("all,!2-65535")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !slices.Equal(spec.TCP, []int{1}) || !slices.Equal(spec.UDP, []int{1}) {
+		t.Errorf("ParsePortSpec(%q) = %+v，期望只剩端口 1", "all,!2-65535", spec)
+	}
+}
+
+func TestCheckPortsStdin(t *testing.T) {
+	tests := []struct {
+		hosts, ports string
+		wantErr      bool
+	}{
+		{hosts: "10.0.0.1", ports: Stdin},
+		{hosts: Stdin, ports: "80"},
+		{hosts: Stdin, ports: AllPorts},
+		{hosts: Stdin, ports: Stdin, wantErr: true},
+	}
+	for _, tt := range tests {
+		if err := CheckPortsStdin(tt.hosts, tt.ports); (err != nil) != tt.wantErr {
+			t.Errorf("CheckPortsStdin(%q, %q) 错误 = %v，期望返回错误: %v", tt.hosts, tt.ports, err, tt.wantErr)
+		}
+	}
+}
+
+func TestSelectPorts(t *testing.T) {
+	topTCP, err := topPortList("tcp")
+	if err != nil {
+		t.Fatal(err)
+	}
+	topUDP, err := topPortList("udp")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name     string
+		protocol string
+		ports    string
+		top      int
+		exclude  string
+		want     []int
+		wantErr  bool
+	}{
+		{name: "端口列表", protocol: "tcp", ports: "22,80", want: []int{22, 80}},
+		{name: "只取对应协议", protocol: "udp", ports: "T:22,U:53", want: []int{53}},
+		{name: "排除端口", protocol: "tcp", ports: "20-25", exclude: "21,T:23", want: []int{20, 22, 24, 25}},
+		{name: "排除其他协议的端口", protocol: "tcp", ports: "53", exclude: "U:53", want: []int{53}},
+		{name: "TCP 常用端口", protocol: "tcp", top: 5, want: topTCP[:5]},
+		{name: "UDP 常用端口", protocol: "udp", top: 5, want: topUDP[:5]},
+		{name: "常用端口后排除", protocol: "tcp", top: 2, exclude: strconv.Itoa(topTCP[0]), want: topTCP[1:2]},
+		{name: "TCP 完整列表", protocol: "tcp", top: len(topTCP), want: topTCP},
+		{name: "UDP 完整列表", protocol: "udp", top: len(topUDP), want: topUDP},
+		{name: "超过 UDP 列表长度", protocol: "udp", top: len(topUDP) + 1, wantErr: true},
+		{name: "超过 TCP 列表长度", protocol: "tcp", top: len(topTCP) + 1, wantErr: true},
+		{name: "没有对应协议的端口", protocol: "udp", ports: "T:22", wantErr: true},
+		{name: "排除全部端口", protocol: "tcp", ports: "22", exclude: "22", wantErr: true},
+		{name: "无效的排除端口", protocol: "tcp", ports: "22", exclude: "abc", wantErr: true},
+		{name: "不支持的协议", protocol: "sctp", top: 10, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := SelectPorts(tt.protocol, tt.ports, tt.top, tt.exclude)
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("SelectPorts(%q, %q, %d, %q) 应返回错误，得到 %v", tt.protocol, tt.ports, tt.top, tt.exclude, got)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("SelectPorts(%q, %q, %d, %q) 返回错误: %v", tt.protocol, tt.ports, tt.top, tt.exclude, err)
+			}
+			if !slices.Equal(got, tt.want) {
+				t.Errorf("SelectPorts(%q, %q, %d, %q) = %v，期望 %v", tt.protocol, tt.ports, tt.top, tt.exclude, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSelectPortSpec(t *testing.T) {
+	topTCP, err := topPortList("tcp")
+	if err != nil {
+		t.Fatal(err)
+	}
+	topUDP, err := topPortList("udp")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// top 超过 UDP 列表长度时 UDP 使用整个列表，TCP 仍取前 top 个
+	top := len(topUDP) + 1
+	spec, err := SelectPortSpec("", top, "")
+	if err != nil {
+		t.Fatalf("SelectPortSpec(top=%d) 返回错误: %v", top, err)
+	}
+	if !slices.Equal(spec.TCP, topTCP[:min(top, len(topTCP))]) {
+		t.Errorf("SelectPortSpec(top=%d).TCP 有 %d 个端口，期望 %d", top, len(spec.TCP), min(top, len(topTCP)))
+	}
+	if !slices.Equal(spec.UDP, topUDP) {
+		t.Errorf("SelectPortSpec(top=%d).UDP 有 %d 个端口，期望 %d", top, len(spec.UDP), len(topUDP))
+	}
+
+	// 只有一种协议有剩余端口时不返回错误
+	spec, err = SelectPortSpec("T:22,U:53", 0, "U:53")
+	if err != nil {
+		t.Fatalf("SelectPortSpec 返回错误: %v", err)
+	}
+	if !slices.Equal(spec.TCP, []int{22}) || len(spec.UDP) != 0 {
+		t.Errorf("SelectPortSpec = %+v，期望 TCP [22]、UDP 为空", spec)
+	}
+
+	// 排除后两种协议都没有端口时返回错误
+	if _, err := SelectPortSpec("22", 0, "22"); err == nil {
+		t.Error("排除全部端口时 SelectPortSpec 应返回错误")
+	}
+}
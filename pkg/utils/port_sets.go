@@ -0,0 +1,144 @@
+package utils
+
+import (
+	_ "embed"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+var (
+	//go:embed data/top-tcp-ports.txt
+	topTCPPorts string
+
+	//go:embed data/top-udp-ports.txt
+	topUDPPorts string
+)
+
+// services 常用服务名对应的端口
+var services = map[string]int{
+	"ftp-data":      20,
+	"ftp":           21,
+	"ssh":           22,
+	"telnet":        23,
+	"smtp":          25,
+	"dns":           53,
+	"domain":        53,
+	"dhcp":          67,
+	"tftp":          69,
+	"http":          80,
+	"kerberos":      88,
+	"pop3":          110,
+	"rpcbind":       111,
+	"ntp":           123,
+	"msrpc":         135,
+	"netbios-ns":    137,
+	"netbios-dgm":   138,
+	"netbios-ssn":   139,
+	"imap":          143,
+	"snmp":          161,
+	"snmptrap":      162,
+	"ldap":          389,
+	"https":         443,
+	"smb":           445,
+	"microsoft-ds":  445,
+	"smtps":         465,
+	"syslog":        514,
+	"submission":    587,
+	"ipp":           631,
+	"ldaps":         636,
+	"rsync":         873,
+	"imaps":         993,
+	"pop3s":         995,
+	"mssql":         1433,
+	"oracle":        1521,
+	"pptp":          1723,
+	"mqtt":          1883,
+	"nfs":           2049,
+	"docker":        2375,
+	"mysql":         3306,
+	"rdp":           3389,
+	"postgresql":    5432,
+	"postgres":      5432,
+	"amqp":          5672,
+	"vnc":           5900,
+	"couchdb":       5984,
+	"winrm":         5985,
+	"redis":         6379,
+	"kubernetes":    6443,
+	"http-alt":      8080,
+	"https-alt":     8443,
+	"elasticsearch": 9200,
+	"memcached":     11211,
+	"mongodb":       27017,
+}
+
+// portGroups 内置的命名端口组
+var portGroups = map[string][]int{
+	"web":     {80, 443, 8000, 8008, 8080, 8081, 8443, 8888},
+	"db":      {1433, 1521, 3306, 5432, 5984, 6379, 9200, 11211, 27017},
+	"mail":    {25, 110, 143, 465, 587, 993, 995},
+	"windows": {88, 135, 137, 138, 139, 389, 445, 636, 3389, 5985, 5986},
+}
+
+// namedPorts 解析服务名或端口组名（不区分大小写），返回对应的端口
+func namedPorts(name string) ([]int, bool) {
+	name = strings.ToLower(name)
+	if ports, ok := portGroups[name]; ok {
+		return ports, true
+	}
+	if port, ok := services[name]; ok {
+		return []int{port}, true
+	}
+	return nil, false
+}
+
+// TopPorts 返回按使用频率排序的前 n 个端口，protocol 为 "tcp" 或 "udp"
+func TopPorts(protocol string, n int) ([]int, error) {
+	ports, err := topPortList(protocol)
+	if err != nil {
+		return nil, err
+	}
+
+	if n < 1 || n > len(ports) {
+		return nil, fmt.Errorf("--top-ports 必须在 1-%d 范围内", len(ports))
+	}
+	return ports[:n], nil
+}
+
+// TopPortsLimit 返回 --top-ports 对指定协议允许的最大值，即内置常用端口列表的长度
+func TopPortsLimit(protocol string) int {
+	ports, err := topPortList(protocol)
+	if err != nil {
+		return 0
+	}
+	return len(ports)
+}
+
+// topPortList 返回内置的按使用频率排序的全部端口
+func topPortList(protocol string) ([]int, error) {
+	var data string
+	switch protocol {
+	case "tcp":
+		data = topTCPPorts
+	case "udp":
+		data = topUDPPorts
+	default:
+		return nil, fmt.Errorf("不支持的协议: %s", protocol)
+	}
+
+	lines, err := readLines(strings.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+
+	ports := make([]int, 0, len(lines))
+	for _, line := range lines {
+		port, err := strconv.Atoi(line)
+		if err != nil {
+			return nil, fmt.Errorf("无效的内置端口: %s", line)
+		}
+		ports = append(ports, port)
+	}
+	return ports, nil
+}
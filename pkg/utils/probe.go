@@ -0,0 +1,22 @@
+package utils
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// ParseProbe 解析命令行中的探测数据，支持 Go 字符串转义 (如 \r\n、\x00、\t)
+// 例如 "HEAD / HTTP/1.0\r\n\r\n"
+func ParseProbe(probe string) ([]byte, error) {
+	if probe == "" {
+		return nil, nil
+	}
+
+	// 转义双引号后按双引号字符串解析
+	unquoted, err := strconv.Unquote(`"` + strings.ReplaceAll(probe, `"`, `\"`) + `"`)
+	if err != nil {
+		return nil, fmt.Errorf("无效的探测数据: %s", probe)
+	}
+	return []byte(unquoted), nil
+}
@@ -0,0 +1,271 @@
+package utils
+
+import (
+	"encoding/binary"
+	"iter"
+	"math/bits"
+	"net/netip"
+	"slices"
+	"strings"
+)
+
+const (
+	// maxIPv6RangeBits IPv6 网段最多展开的主机位数
+	maxIPv6RangeBits = 16
+
+	// maxIPv6RangeSize IPv6 网段或地址范围最多包含的地址数量
+	maxIPv6RangeSize = 1 << maxIPv6RangeBits
+)
+
+// Targets 惰性展开的目标列表
+// CIDR、IP 范围和八位组模式只记录描述，遍历时才逐个生成，Len 无需展开即可得到总数
+type Targets struct {
+	items []targetItem
+	count int
+
+	exclusion bool // 是否为排除列表，排除列表中的 CIDR 包含网络地址和广播地址
+}
+
+// targetItem 单个目标条目：主机名、单个地址、连续的地址范围或八位组模式
+type targetItem struct {
+	host  string     // 主机名或单个地址，为空时表示地址范围或八位组模式
+	first netip.Addr // 地址范围起点
+	last  netip.Addr // 地址范围终点
+
+	pattern  *octetPattern // 八位组模式，不为空时忽略 first 和 last
+	excluded []targetItem  // 八位组模式中需要跳过的地址区间，按起点排序且互不重叠
+}
+
+// Len 返回目标总数，不会展开地址范围
+func (t *Targets) Len() int {
+	return t.count
+}
+
+// All 返回按需生成目标地址的迭代器，可以多次遍历
+func (t *Targets) All() iter.Seq[string] {
+	return func(yield func(string) bool) {
+		for _, item := range t.items {
+			// 主机名或单个地址
+			if item.host != "" {
+				if !yield(item.host) {
+					return
+				}
+				continue
+			}
+
+			// 逐个生成八位组模式中未被排除的地址
+			if item.pattern != nil {
+				excluded := item.excluded
+				for addr := range item.pattern.addrs() {
+					for len(excluded) > 0 && excluded[0].last.Compare(addr) < 0 {
+						excluded = excluded[1:]
+					}
+					if len(excluded) > 0 && excluded[0].first.Compare(addr) <= 0 {
+						continue
+					}
+					if !yield(addr.String()) {
+						return
+					}
+				}
+				continue
+			}
+
+			// 逐个生成地址范围内的地址
+			for addr := item.first; addr.IsValid() && addr.Compare(item.last) <= 0; addr = addr.Next() {
+				if !yield(addr.String()) {
+					return
+				}
+			}
+		}
+	}
+}
+
+// addHost 添加主机名或单个地址
+func (t *Targets) addHost(host string) {
+	t.items = append(t.items, targetItem{host: host})
+	t.count++
+}
+
+// addRange 添加连续的地址范围（包含起止地址）
+func (t *Targets) addRange(first, last netip.Addr) {
+	t.items = append(t.items, targetItem{first: first, last: last})
+	t.count += rangeSize(first, last)
+}
+
+// addPattern 添加八位组模式
+func (t *Targets) addPattern(pattern *octetPattern) {
+	t.items = append(t.items, targetItem{pattern: pattern})
+	t.count += pattern.size()
+}
+
+// Exclude 从目标列表中排除 excluded 包含的地址和主机名，excluded 为 nil 时不做处理
+// 地址范围会被拆分为不含排除地址的若干子范围，遍历时无需逐个过滤
+func (t *Targets) Exclude(excluded *Targets) {
+	if excluded == nil || len(excluded.items) == 0 {
+		return
+	}
+
+	names, ranges := excluded.exclusions()
+
+	items := t.items
+	t.items, t.count = nil, 0
+	for _, item := range items {
+		// 八位组模式记录需要跳过的区间，遍历时过滤
+		if item.pattern != nil {
+			item.excluded = mergeRanges(append(slices.Clone(item.excluded), overlapping(ranges, item.pattern.first(), item.pattern.last())...))
+			if n := item.pattern.size() - item.pattern.countIn(item.excluded); n > 0 {
+				t.items = append(t.items, item)
+				t.count += n
+			}
+			continue
+		}
+
+		// 地址范围扣除排除的区间
+		if item.host == "" {
+			for _, r := range subtractRanges(item.first, item.last, ranges) {
+				t.addRange(r.first, r.last)
+			}
+			continue
+		}
+
+		// 单个地址或主机名
+		if !isExcludedHost(item.host, names, ranges) {
+			t.addHost(item.host)
+		}
+	}
+}
+
+// isExcludedHost 检查单个地址是否落在排除区间内，或主机名是否被排除（不区分大小写）
+func isExcludedHost(host string, names map[string]bool, ranges []targetItem) bool {
+	if addr, err := netip.ParseAddr(host); err == nil {
+		return len(overlapping(ranges, addr, addr)) > 0
+	}
+	return names[strings.ToLower(host)]
+}
+
+// exclusions 将目标列表整理为主机名集合和按起点排序、互不重叠的地址区间
+func (t *Targets) exclusions() (map[string]bool, []targetItem) {
+	names := make(map[string]bool)
+	var ranges []targetItem
+	for _, item := range t.items {
+		if item.pattern != nil {
+			ranges = append(ranges, item.pattern.ranges()...)
+			continue
+		}
+
+		if item.host == "" {
+			ranges = append(ranges, targetItem{first: item.first, last: item.last})
+			continue
+		}
+
+		if addr, err := netip.ParseAddr(item.host); err == nil {
+			ranges = append(ranges, targetItem{first: addr, last: addr})
+		} else {
+			names[strings.ToLower(item.host)] = true
+		}
+	}
+
+	return names, mergeRanges(withMappedRanges(ranges))
+}
+
+// withMappedRanges 为 IPv4 区间补充对应的 IPv4 映射地址区间 (::ffff:a.b.c.d)，为落在映射地址空间内的 IPv6 区间补充对应的 IPv4 区间
+// 两种写法表示同一个地址，排除其中一种时另一种也会被排除
+func withMappedRanges(ranges []targetItem) []targetItem {
+	mappedFirst := netip.AddrFrom16([16]byte{10: 0xff, 11: 0xff})
+	mappedLast := netip.AddrFrom16([16]byte{10: 0xff, 11: 0xff, 12: 0xff, 13: 0xff, 14: 0xff, 15: 0xff})
+
+	result := slices.Clone(ranges)
+	for _, r := range ranges {
+		if r.first.Is4() {
+			result = append(result, targetItem{first: netip.AddrFrom16(r.first.As16()), last: netip.AddrFrom16(r.last.As16())})
+			continue
+		}
+
+		// 只取与映射地址空间重叠的部分
+		first, last := r.first.WithZone(""), r.last.WithZone("")
+		if first.Compare(mappedFirst) < 0 {
+			first = mappedFirst
+		}
+		if last.Compare(mappedLast) > 0 {
+			last = mappedLast
+		}
+		if first.Compare(last) <= 0 {
+			result = append(result, targetItem{first: first.Unmap(), last: last.Unmap()})
+		}
+	}
+	return result
+}
+
+// mergeRanges 将地址区间按起点排序，并合并重叠或相邻的区间
+func mergeRanges(ranges []targetItem) []targetItem {
+	slices.SortFunc(ranges, func(a, b targetItem) int {
+		return a.first.Compare(b.first)
+	})
+	merged := ranges[:0]
+	for _, r := range ranges {
+		if n := len(merged); n > 0 {
+			prev := &merged[n-1]
+			// 地址族的最后一个地址没有后继，同族的后续区间必然与之重叠
+			next := prev.last.Next()
+			if r.first.BitLen() == prev.last.BitLen() && (!next.IsValid() || r.first.Compare(next) <= 0) {
+				if r.last.Compare(prev.last) > 0 {
+					prev.last = r.last
+				}
+				continue
+			}
+		}
+		merged = append(merged, r)
+	}
+	return merged
+}
+
+// overlapping 返回已排序且互不重叠的区间中与 [first, last] 重叠的部分
+func overlapping(ranges []targetItem, first, last netip.Addr) []targetItem {
+	start, _ := slices.BinarySearchFunc(ranges, first, func(r targetItem, addr netip.Addr) int {
+		return r.last.Compare(addr)
+	})
+	end := start
+	for end < len(ranges) && ranges[end].first.Compare(last) <= 0 {
+		end++
+	}
+	return ranges[start:end]
+}
+
+// subtractRanges 从 [first, last] 中扣除已排序且互不重叠的区间，返回剩余的子范围
+func subtractRanges(first, last netip.Addr, ranges []targetItem) []targetItem {
+	var remaining []targetItem
+	cur := first
+	for _, r := range ranges {
+		// 跳过当前位置之前的区间
+		if r.last.Compare(cur) < 0 {
+			continue
+		}
+		// 之后的区间都不再重叠
+		if r.first.Compare(last) > 0 {
+			break
+		}
+
+		if r.first.Compare(cur) > 0 {
+			remaining = append(remaining, targetItem{first: cur, last: r.first.Prev()})
+		}
+		cur = r.last.Next()
+		if !cur.IsValid() || cur.Compare(last) > 0 {
+			return remaining
+		}
+	}
+	return append(remaining, targetItem{first: cur, last: last})
+}
+
+// rangeSize 计算地址范围内的地址数量
+func rangeSize(first, last netip.Addr) int {
+	distance, _ := addrDistance(first, last)
+	return int(distance) + 1
+}
+
+// addrDistance 计算两个地址之间的差值，差值超出 uint64 时返回 false
+func addrDistance(first, last netip.Addr) (uint64, bool) {
+	a, b := first.As16(), last.As16()
+	lo, borrow := bits.Sub64(binary.BigEndian.Uint64(b[8:]), binary.BigEndian.Uint64(a[8:]), 0)
+	hi, _ := bits.Sub64(binary.BigEndian.Uint64(b[:8]), binary.BigEndian.Uint64(a[:8]), borrow)
+	return lo, hi == 0
+}
@@ -0,0 +1,62 @@
+package utils
+
+import (
+	"slices"
+	"testing"
+)
+
+func TestTargetsExclude(t *testing.T) {
+	tests := []struct {
+		name    string
+		hosts   string
+		exclude string
+		want    []string
+	}{
+		{name: "排除单个地址", hosts: "10.0.0.1-5", exclude: "10.0.0.3", want: []string{"10.0.0.1", "10.0.0.2", "10.0.0.4", "10.0.0.5"}},
+		{name: "排除范围", hosts: "10.0.0.1-5", exclude: "10.0.0.2-4", want: []string{"10.0.0.1", "10.0.0.5"}},
+		{name: "排除网段包含网络地址", hosts: "10.0.0.0/31,10.0.0.9", exclude: "10.0.0.0/30", want: []string{"10.0.0.9"}},
+		{name: "排除全部", hosts: "10.0.0.1-3", exclude: "10.0.0.0/24", want: nil},
+		{name: "主机名不区分大小写", hosts: "Example.com,example.org", exclude: "EXAMPLE.COM", want: []string{"example.org"}},
+		{name: "排除八位组模式", hosts: "10.0.0.1-6", exclude: "10.0.0.2,4,6", want: []string{"10.0.0.1", "10.0.0.3", "10.0.0.5"}},
+		{name: "从八位组模式中排除", hosts: "10.0-1.0.1", exclude: "10.1.0.0/24", want: []string{"10.0.0.1"}},
+		{name: "IPv6 范围", hosts: "2001:db8::1-4", exclude: "2001:db8::2-3", want: []string{"2001:db8::1", "2001:db8::4"}},
+		{name: "IPv4 排除映射地址", hosts: "::ffff:10.0.0.1,::ffff:10.0.0.2,10.0.0.2", exclude: "10.0.0.1-2", want: nil},
+		{name: "映射地址排除 IPv4", hosts: "10.0.0.1-3", exclude: "::ffff:10.0.0.2", want: []string{"10.0.0.1", "10.0.0.3"}},
+		{name: "IPv4 网段排除映射地址范围", hosts: "::ffff:10.0.0.254-::ffff:10.0.1.1", exclude: "10.0.0.0/24", want: []string{"::ffff:10.0.1.0", "::ffff:10.0.1.1"}},
+		{name: "IPv4 排除不影响普通 IPv6", hosts: "::a00:1", exclude: "10.0.0.1", want: []string{"::a00:1"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			targets, err := ParseTargets(tt.hosts)
+			if err != nil {
+				t.Fatalf("ParseTargets(%q) 返回错误: %v", tt.hosts, err)
+			}
+			excluded, err := ParseExcludes(tt.exclude, "")
+			if err != nil {
+				t.Fatalf("ParseExcludes(%q) 返回错误: %v", tt.exclude, err)
+			}
+
+			targets.Exclude(excluded)
+			got := slices.Collect(targets.All())
+			if !slices.Equal(got, tt.want) {
+				t.Errorf("排除 %q 后 %q = %v，期望 %v", tt.exclude, tt.hosts, got, tt.want)
+			}
+			if targets.Len() != len(tt.want) {
+				t.Errorf("排除 %q 后 %q 的 Len() = %d，期望 %d", tt.exclude, tt.hosts, targets.Len(), len(tt.want))
+			}
+		})
+	}
+}
+
+func TestTargetsExcludeNil(t *testing.T) {
+	targets, err := ParseTargets("10.0.0.1-2")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	targets.Exclude(nil)
+	if got := slices.Collect(targets.All()); !slices.Equal(got, []string{"10.0.0.1", "10.0.0.2"}) {
+		t.Errorf("Exclude(nil) 后 = %v", got)
+	}
+}